@@ -0,0 +1,210 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Usage metrics. Storage is the bytes stored now, the others are metered
+// per billing period.
+const (
+	MetricAPICalls   = "api_calls"
+	MetricAIRequests = "ai_requests"
+	MetricStorage    = "storage_bytes"
+)
+
+// Plan constants
+const (
+	PlanFree = "free"
+	PlanPro  = "pro"
+
+	DefaultPlan = PlanFree
+)
+
+// Invoice status constants
+const (
+	InvoiceStatusOpen = "open"
+	InvoiceStatusPaid = "paid"
+	InvoiceStatusVoid = "void"
+)
+
+// Coupon duration constants
+const (
+	CouponDurationOnce      = "once"
+	CouponDurationRepeating = "repeating"
+	CouponDurationForever   = "forever"
+)
+
+// Plan describes a billable plan. Quotas are per billing period; a metric
+// missing from Quotas is unlimited. Amounts are in minor currency units.
+type Plan struct {
+	Key        string
+	Name       string
+	Price      int64
+	UnitPrices map[string]int64
+	Quotas     map[string]int64
+}
+
+var Plans = map[string]Plan{
+	PlanFree: {
+		Key:  PlanFree,
+		Name: "Free",
+		Quotas: map[string]int64{
+			MetricAPICalls:   10000,
+			MetricAIRequests: 50,
+			MetricStorage:    100 << 20,
+		},
+	},
+	PlanPro: {
+		Key:   PlanPro,
+		Name:  "Pro",
+		Price: 2900,
+		UnitPrices: map[string]int64{
+			MetricAIRequests: 1,
+		},
+		Quotas: map[string]int64{
+			MetricAPICalls:   1000000,
+			MetricAIRequests: 5000,
+			MetricStorage:    10 << 30,
+		},
+	},
+}
+
+// PlanKeys returns the keys of Plans in order
+func PlanKeys() []string {
+	keys := make([]string, 0, len(Plans))
+	for key := range Plans {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func GetPlan(key string) Plan {
+	if plan, ok := Plans[key]; ok {
+		return plan
+	}
+	return Plans[DefaultPlan]
+}
+
+// GetUsageSoftLimits returns the quota fractions at which usage warnings are
+// raised, e.g. USAGE_SOFT_LIMITS=0.8,0.9
+func GetUsageSoftLimits() []float64 {
+	raw := os.Getenv("USAGE_SOFT_LIMITS")
+	if raw == "" {
+		return []float64{0.8, 0.9}
+	}
+
+	var limits []float64
+	for _, part := range strings.Split(raw, ",") {
+		limit, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err == nil && limit > 0 && limit < 1 {
+			limits = append(limits, limit)
+		}
+	}
+	return limits
+}
+
+func GetCurrency() string {
+	if currency := os.Getenv("BILLING_CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "USD"
+}
+
+// GetTaxRate returns the tax percentage applied to invoices
+func GetTaxRate() float64 {
+	rate, err := strconv.ParseFloat(os.Getenv("BILLING_TAX_RATE"), 64)
+	if err != nil || rate < 0 {
+		return 0
+	}
+	return rate
+}
+
+// GetInvoiceSeller returns the seller invoices are issued by. Invoice numbers
+// are sequential per seller.
+func GetInvoiceSeller() string {
+	if seller := os.Getenv("INVOICE_SELLER"); seller != "" {
+		return seller
+	}
+	return "StarterSaaS"
+}
+
+func GetInvoiceSellerAddress() string {
+	return os.Getenv("INVOICE_SELLER_ADDRESS")
+}
+
+func GetInvoicePrefix() string {
+	if prefix := os.Getenv("INVOICE_PREFIX"); prefix != "" {
+		return prefix
+	}
+	return "INV"
+}
+
+// GetTrialDays returns the length of the free trial new users start with; 0
+// disables trials
+func GetTrialDays() int {
+	return getEnvInt("TRIAL_DAYS", 14)
+}
+
+// GetTrialPlan returns the plan trials run on. A trial continues on a plan
+// only when the user checks out, and reverts to DefaultPlan otherwise.
+func GetTrialPlan() string {
+	if plan := os.Getenv("TRIAL_PLAN"); plan != "" {
+		return plan
+	}
+	return PlanPro
+}
+
+// GetTrialReminderDays returns how many days before the trial ends the
+// reminder email is sent
+func GetTrialReminderDays() int {
+	return getEnvInt("TRIAL_REMINDER_DAYS", 3)
+}
+
+// GetDunningSchedule returns the days after a failed payment at which the
+// payment is retried, e.g. DUNNING_SCHEDULE=1,3,7
+func GetDunningSchedule() []int {
+	raw := os.Getenv("DUNNING_SCHEDULE")
+	if raw == "" {
+		return []int{1, 3, 7}
+	}
+
+	var schedule []int
+	for _, part := range strings.Split(raw, ",") {
+		days, err := strconv.Atoi(strings.TrimSpace(part))
+		if err == nil && days >= 0 {
+			schedule = append(schedule, days)
+		}
+	}
+	return schedule
+}
+
+// GetDunningFinalAction returns what happens when the dunning schedule is
+// exhausted: "downgrade" to the default plan or "suspend" access
+func GetDunningFinalAction() string {
+	if os.Getenv("DUNNING_FINAL_ACTION") == "suspend" {
+		return "suspend"
+	}
+	return "downgrade"
+}
+
+// GetJobInterval returns how often scheduled background jobs run
+func GetJobInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("JOB_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return 15 * time.Minute
+	}
+	return interval
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
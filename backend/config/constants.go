@@ -7,6 +7,9 @@ const (
 	StatusPending   = "pending"
 	StatusCompleted = "completed"
 	StatusCancelled = "cancelled"
+	StatusTrialing  = "trialing"
+	StatusPastDue   = "past_due"
+	StatusSuspended = "suspended"
 )
 
 // Role constants
@@ -15,6 +18,15 @@ const (
 	RoleAdmin = "admin"
 )
 
+// Feature flag constants
+const (
+	FlagTypeBoolean      = "boolean"
+	FlagTypeMultivariate = "multivariate"
+
+	FlagOn  = "on"
+	FlagOff = "off"
+)
+
 // Default values
 const (
 	DefaultUserRole = RoleUser
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -60,4 +61,54 @@ func GetMigrationsPath() string {
 
 func GetGeminiKey() string {
 	return os.Getenv("GEMINI_API_KEY")
-}
\ No newline at end of file
+}
+
+// GetAdminSearchIndex returns the index created for admin search fields:
+// "trigram", "tsvector" or "" for none. A tsvector index makes search match
+// whole words instead of substrings.
+func GetAdminSearchIndex() string {
+	return os.Getenv("ADMIN_SEARCH_INDEX")
+}
+
+// GetAdminStatsTTL returns how long computed admin statistics are cached
+func GetAdminStatsTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("ADMIN_STATS_TTL"))
+	if err != nil || ttl < 0 {
+		return time.Minute
+	}
+	return ttl
+}
+
+// GetResponseCacheTTL returns how long responses of public endpoints are
+// cached in process, with 0 disabling the cache. Changes made through other
+// instances show up once it expires.
+func GetResponseCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("RESPONSE_CACHE_TTL"))
+	if err != nil || ttl < 0 {
+		return 5 * time.Minute
+	}
+	return ttl
+}
+
+// GetTokenRevocationTTL returns how long the time a user's tokens were last
+// revoked is cached for authenticating requests. Revocations made through
+// other instances take up to this long to apply.
+func GetTokenRevocationTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("TOKEN_REVOCATION_TTL"))
+	if err != nil || ttl < 0 {
+		return 30 * time.Second
+	}
+	return ttl
+}
+
+// GetAuditRetentionDays returns how many days audit log entries are kept,
+// with 0 keeping them forever
+func GetAuditRetentionDays() int {
+	return getEnvInt("AUDIT_RETENTION_DAYS", 365)
+}
+
+// GetTrashRetentionDays returns how many days soft-deleted records stay in
+// the admin trash before they are purged, with 0 keeping them forever
+func GetTrashRetentionDays() int {
+	return getEnvInt("TRASH_RETENTION_DAYS", 30)
+}
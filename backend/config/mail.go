@@ -0,0 +1,35 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// GetSMTPHost returns the SMTP server used for outgoing mail. Without one,
+// emails are written to the log instead.
+func GetSMTPHost() string {
+	return os.Getenv("SMTP_HOST")
+}
+
+func GetSMTPPort() int {
+	port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if err != nil {
+		return 587
+	}
+	return port
+}
+
+func GetSMTPUser() string {
+	return os.Getenv("SMTP_USER")
+}
+
+func GetSMTPPassword() string {
+	return os.Getenv("SMTP_PASSWORD")
+}
+
+func GetMailFrom() string {
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		return from
+	}
+	return "no-reply@example.com"
+}
@@ -8,10 +8,38 @@ import (
 func RunMigrations() error {
 	log.Println("Running database migrations...")
 
+	// Unique keys of soft-deleted models are partial indexes over live rows,
+	// so a deleted email or key can be used again. Drop the full constraints
+	// and indexes they replace.
+	for _, sql := range []string{
+		`ALTER TABLE IF EXISTS users DROP CONSTRAINT IF EXISTS users_email_key`,
+		`ALTER TABLE IF EXISTS users DROP CONSTRAINT IF EXISTS uni_users_email`,
+		`DROP INDEX IF EXISTS idx_feature_flags_key`,
+		`DROP INDEX IF EXISTS idx_promotion_codes_code`,
+	} {
+		if err := DB.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+
 	err := DB.AutoMigrate(
 		&models.User{},
 
 		&models.Setting{},
+
+		&models.Subscription{},
+		&models.SubscriptionEvent{},
+		&models.UsageEvent{},
+		&models.UsageRecord{},
+		&models.Invoice{},
+		&models.InvoiceLine{},
+		&models.InvoiceSequence{},
+		&models.FeatureFlag{},
+		&models.Coupon{},
+		&models.PromotionCode{},
+		&models.CouponRedemption{},
+		&models.AuditLog{},
+		&models.RecordVersion{},
 	)
 
 	if err != nil {
@@ -3,12 +3,14 @@ package main
 import (
 	"platform/backend/config"
 	"platform/backend/db"
+	"platform/backend/middleware"
 	"platform/backend/routes"
 	"platform/backend/models"
 	"platform/backend/utils"
 
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -24,6 +26,9 @@ func main() {
 	utils.TryErr(config.LoadEnv())
 	utils.TryErr(db.InitDB())
 	utils.TryErr(db.RunMigrations())
+	utils.TryErr(utils.RegisterVersioning(db.DB))
+	utils.TryErr(utils.RegisterResponseCacheInvalidation(db.DB))
+	utils.TryErr(utils.EnsureAdminSearchIndexes())
 
 	adminEmail := os.Getenv("ADMIN_EMAIL")
 	if adminEmail != "" {
@@ -46,16 +51,33 @@ func main() {
 		}
 	}
 
+	utils.Every("close billing periods", config.GetJobInterval(), func() error {
+		return utils.CloseBillingPeriods(time.Now().UTC())
+	})
+	utils.Every("send trial reminders", config.GetJobInterval(), func() error {
+		return utils.SendTrialReminders(time.Now().UTC())
+	})
+	utils.Every("process dunning", config.GetJobInterval(), func() error {
+		return utils.ProcessDunning(time.Now().UTC())
+	})
+	utils.Every("purge audit log", config.GetJobInterval(), func() error {
+		return utils.PurgeAuditLog(time.Now().UTC())
+	})
+	utils.Every("purge trash", config.GetJobInterval(), func() error {
+		return utils.PurgeTrash(time.Now().UTC())
+	})
+
 	r := gin.New()
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
+	r.Use(middleware.RequestID())
 	r.RedirectTrailingSlash = false 
 
 	r.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With", "X-Request-ID", "If-Match", "If-None-Match", "If-Modified-Since"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Type", "X-Request-ID", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           86400, 
 	}))
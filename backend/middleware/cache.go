@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+
+	"platform/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheControl sets the Cache-Control header of the route's responses, e.g.
+// "public, max-age=60"
+func CacheControl(directives string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", directives)
+		c.Next()
+	}
+}
+
+// Conditional makes the route answer conditional GET requests, with an ETag
+// hashed from the response body unless the handler sets one
+func Conditional() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		utils.EnableConditional(c)
+		c.Next()
+	}
+}
+
+// CacheResponses serves GET requests from an in-process cache of earlier
+// responses, which changes to the tables they were read from invalidate. It
+// is for public endpoints only, as responses are shared between users, and
+// for handlers that ignore the query string, as responses are cached by
+// path.
+func CacheResponses(tables ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+
+		key := c.Request.URL.Path
+		if body, lastModified, ok := utils.CachedResponse(key); ok {
+			if lastModified != "" {
+				c.Header("Last-Modified", lastModified)
+			}
+			utils.WriteConditional(c, utils.StatusOK, body)
+			c.Abort()
+			return
+		}
+
+		generation := utils.ResponseGeneration(tables)
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if c.Writer.Status() == http.StatusOK && recorder.body.Len() > 0 {
+			utils.CacheResponse(key, tables, recorder.body.Bytes(), c.Writer.Header().Get("Last-Modified"), generation)
+		}
+	}
+}
+
+// bodyRecorder keeps a copy of the response body
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"platform/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Quota meters every request against the user's plan quota for metric and
+// rejects it once the quota is used up. Failed requests are given back.
+func Quota(metric string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := GetUserID(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		status, err := utils.ConsumeQuota(userID, metric, 1)
+		if errors.Is(err, utils.ErrQuotaExceeded) {
+			utils.Respond(c, utils.StatusTooManyRequests, err.Error(), nil)
+			c.Abort()
+			return
+		}
+		if errors.Is(err, utils.ErrSubscriptionSuspended) {
+			utils.Respond(c, utils.StatusPaymentRequired, err.Error(), nil)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			utils.ServerErrorResponse(c, err)
+			c.Abort()
+			return
+		}
+
+		if status.Warning != "" {
+			c.Header("X-Usage-Warning", status.Warning)
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= 400 {
+			if err := utils.ReleaseQuota(userID, metric, 1); err != nil {
+				log.Printf("Failed to release %s usage for user %s: %v", metric, userID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrAuditLogImmutable = errors.New("audit log entries cannot be changed")
+
+// AuditLog is an append-only record of a change, written in the same
+// transaction as the change itself
+type AuditLog struct {
+	ID        uuid.UUID              `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt time.Time              `gorm:"index" json:"createdAt" admin:"list"`
+	ActorID   *uuid.UUID             `gorm:"type:uuid;index" json:"actorId" admin:"list,label=Actor,ref=user"`
+	Action    string                 `gorm:"type:varchar(32);index;not null" json:"action" admin:"list,search"`
+	Resource  string                 `gorm:"type:varchar(64);index;not null" json:"resource" admin:"list,search"`
+	RecordID  string                 `gorm:"type:varchar(64);index" json:"recordId" admin:"list,search,label=Record"`
+	Changes   map[string]AuditChange `gorm:"type:jsonb;serializer:json" json:"changes"`
+	Result    json.RawMessage        `gorm:"type:jsonb" json:"result,omitempty"`
+	IP        string                 `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent string                 `gorm:"type:text" json:"userAgent"`
+	RequestID string                 `gorm:"type:varchar(64);index" json:"requestId" admin:"search,label=Request"`
+}
+
+// AuditChange holds the JSON values of a field before and after a change.
+// Before is null for created records and After for deleted ones.
+type AuditChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+func (a *AuditLog) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
@@ -9,9 +9,9 @@ import (
 
 // BaseModel contains common fields for all models
 type BaseModel struct {
-	ID        uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
-	CreatedAt time.Time      `json:"createdAt"`
-	UpdatedAt time.Time      `json:"updatedAt"`
+	ID        uuid.UUID      `gorm:"type:uuid;primary_key" json:"id" admin:"readonly" query:"true"`
+	CreatedAt time.Time      `json:"createdAt" admin:"readonly" query:"true"`
+	UpdatedAt time.Time      `json:"updatedAt" admin:"readonly" query:"true"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"platform/backend/config"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Coupon is a discount of either PercentOff or AmountOff (in minor units) on
+// invoices. Duration is once, repeating for DurationInPeriods billing
+// periods, or forever. Plans restricts the coupon to some plans.
+type Coupon struct {
+	BaseModel
+	Versioned
+	Name              string     `gorm:"not null" json:"name" admin:"list,search,order=1"`
+	PercentOff        float64    `json:"percentOff" admin:"list"`
+	AmountOff         int64      `json:"amountOff" admin:"list,help=Amount in minor currency units"`
+	Currency          string     `gorm:"type:varchar(3)" json:"currency"`
+	Duration          string     `gorm:"type:varchar(16);default:'once'" json:"duration" binding:"omitempty,oneof=once repeating forever" admin:"list"`
+	DurationInPeriods int        `json:"durationInPeriods"`
+	MaxRedemptions    int        `json:"maxRedemptions"`
+	TimesRedeemed     int        `gorm:"default:0" json:"timesRedeemed" admin:"readonly"`
+	ExpiresAt         *time.Time `json:"expiresAt"`
+	Plans             []string   `gorm:"type:jsonb;serializer:json" json:"plans"`
+}
+
+// PromotionCode is a customer facing code that redeems a coupon
+type PromotionCode struct {
+	BaseModel
+	Code           string     `gorm:"uniqueIndex:idx_promotion_codes_live_code,where:deleted_at IS NULL;not null" json:"code" admin:"list,search,order=1"`
+	CouponID       uuid.UUID  `gorm:"type:uuid;index;not null" json:"couponId" admin:"ref=coupon"`
+	Active         bool       `gorm:"default:true" json:"active" admin:"list"`
+	MaxRedemptions int        `json:"maxRedemptions"`
+	TimesRedeemed  int        `gorm:"default:0" json:"timesRedeemed"`
+	ExpiresAt      *time.Time `json:"expiresAt"`
+}
+
+// CouponRedemption applies a coupon to a subscription until EndedAt
+type CouponRedemption struct {
+	BaseModel
+	CouponID        uuid.UUID  `gorm:"type:uuid;index;not null" json:"couponId" admin:"ref=coupon"`
+	PromotionCodeID *uuid.UUID `gorm:"type:uuid;index" json:"promotionCodeId" admin:"ref=promotionCode"`
+	SubscriptionID  uuid.UUID  `gorm:"type:uuid;index;not null" json:"subscriptionId" admin:"ref=subscription"`
+	UserID          uuid.UUID  `gorm:"type:uuid;index;not null" json:"userId" admin:"ref=user"`
+	OrganizationID  *uuid.UUID `gorm:"type:uuid;index" json:"organizationId"`
+	PeriodsApplied  int        `gorm:"default:0" json:"periodsApplied"`
+	EndedAt         *time.Time `json:"endedAt"`
+}
+
+func (c *Coupon) BeforeSave(tx *gorm.DB) error {
+	if (c.PercentOff > 0) == (c.AmountOff > 0) {
+		return errors.New("coupon needs either percentOff or amountOff")
+	}
+	if c.PercentOff > 100 || c.PercentOff < 0 || c.AmountOff < 0 {
+		return errors.New("coupon discount is out of range")
+	}
+	switch c.Duration {
+	case config.CouponDurationOnce, config.CouponDurationForever:
+	case config.CouponDurationRepeating:
+		if c.DurationInPeriods <= 0 {
+			return errors.New("repeating coupons need durationInPeriods")
+		}
+	default:
+		return errors.New("coupon duration must be once, repeating or forever")
+	}
+	c.Currency = strings.ToUpper(c.Currency)
+	return nil
+}
+
+func (p *PromotionCode) BeforeSave(tx *gorm.DB) error {
+	p.Code = strings.ToUpper(strings.TrimSpace(p.Code))
+	if p.Code == "" {
+		return errors.New("promotion code cannot be empty")
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"platform/backend/config"
+
+	"gorm.io/gorm"
+)
+
+type FeatureFlag struct {
+	BaseModel
+	Versioned
+	Key            string     `gorm:"uniqueIndex:idx_feature_flags_live_key,where:deleted_at IS NULL;not null" json:"key" admin:"list,search,order=1"`
+	Description    string     `json:"description" admin:"search,widget=textarea"`
+	Type           string     `gorm:"type:varchar(16);default:'boolean'" json:"type" binding:"omitempty,oneof=boolean multivariate" admin:"list"`
+	Enabled        bool       `gorm:"default:false" json:"enabled" admin:"list"`
+	Variants       []string   `gorm:"type:jsonb;serializer:json" json:"variants"`
+	DefaultVariant string     `json:"defaultVariant"`
+	Rules          []FlagRule `gorm:"type:jsonb;serializer:json" json:"rules" admin:"help=Evaluated in order; the first matching rule decides the variant"`
+}
+
+// FlagRule serves Variant when Attribute of the evaluated user matches one of
+// Values. Rules without an attribute match everyone. Percentage limits the
+// rule to a stable share of users, taken after the shares of the percentage
+// rules before it, so that rules of 50 and 50 split users evenly.
+type FlagRule struct {
+	Attribute  string   `json:"attribute,omitempty"`
+	Values     []string `json:"values,omitempty"`
+	Percentage *int     `json:"percentage,omitempty"`
+	Variant    string   `json:"variant,omitempty"`
+}
+
+var flagAttributes = []string{"", "user", "org", "role", "plan"}
+
+func (f *FeatureFlag) BeforeSave(tx *gorm.DB) error {
+	return f.Validate()
+}
+
+func (f *FeatureFlag) Validate() error {
+	switch f.Type {
+	case config.FlagTypeBoolean, "":
+		f.Type = config.FlagTypeBoolean
+		f.Variants = []string{config.FlagOff, config.FlagOn}
+		if f.DefaultVariant == "" {
+			f.DefaultVariant = config.FlagOff
+		}
+	case config.FlagTypeMultivariate:
+		if len(f.Variants) == 0 {
+			return fmt.Errorf("multivariate flag %s needs variants", f.Key)
+		}
+	default:
+		return fmt.Errorf("unknown flag type %q", f.Type)
+	}
+
+	if !containsString(f.Variants, f.DefaultVariant) {
+		return fmt.Errorf("default variant %q is not a variant of %s", f.DefaultVariant, f.Key)
+	}
+
+	share := 0
+	for i, rule := range f.Rules {
+		if !containsString(flagAttributes, rule.Attribute) {
+			return fmt.Errorf("rule %d: unknown attribute %q", i+1, rule.Attribute)
+		}
+		if rule.Percentage != nil {
+			if *rule.Percentage < 0 || *rule.Percentage > 100 {
+				return fmt.Errorf("rule %d: percentage must be between 0 and 100", i+1)
+			}
+			if share += *rule.Percentage; share > 100 {
+				return fmt.Errorf("rule %d: the percentages of the rules add up to more than 100", i+1)
+			}
+		}
+		if rule.Variant != "" && !containsString(f.Variants, rule.Variant) {
+			return fmt.Errorf("rule %d: %q is not a variant of %s", i+1, rule.Variant, f.Key)
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
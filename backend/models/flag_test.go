@@ -0,0 +1,46 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"platform/backend/config"
+)
+
+func percentage(p int) *int {
+	return &p
+}
+
+func TestFeatureFlagValidate(t *testing.T) {
+	flag := FeatureFlag{Key: "beta"}
+	if err := flag.Validate(); err != nil {
+		t.Fatalf("a flag without type: %v", err)
+	}
+	if flag.Type != config.FlagTypeBoolean || flag.DefaultVariant != config.FlagOff {
+		t.Errorf("a flag without type became %q defaulting to %q", flag.Type, flag.DefaultVariant)
+	}
+
+	tests := []struct {
+		name string
+		flag FeatureFlag
+		err  string
+	}{
+		{"split", FeatureFlag{Type: config.FlagTypeMultivariate, Variants: []string{"a", "b"}, DefaultVariant: "a",
+			Rules: []FlagRule{{Percentage: percentage(50), Variant: "a"}, {Percentage: percentage(50), Variant: "b"}}}, ""},
+		{"over 100 in total", FeatureFlag{Type: config.FlagTypeMultivariate, Variants: []string{"a", "b"}, DefaultVariant: "a",
+			Rules: []FlagRule{{Percentage: percentage(60), Variant: "a"}, {Percentage: percentage(50), Variant: "b"}}},
+			"rule 2: the percentages of the rules add up to more than 100"},
+		{"negative", FeatureFlag{Type: config.FlagTypeBoolean, Rules: []FlagRule{{Percentage: percentage(-1)}}},
+			"rule 1: percentage must be between 0 and 100"},
+		{"unknown type", FeatureFlag{Type: "number"}, `unknown flag type "number"`},
+	}
+	for _, tt := range tests {
+		err := tt.flag.Validate()
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: got error %v, want %s", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Invoice amounts are in minor currency units
+type Invoice struct {
+	BaseModel
+	UserID         uuid.UUID     `gorm:"type:uuid;index;not null" json:"userId" admin:"list,ref=user"`
+	SubscriptionID uuid.UUID     `gorm:"type:uuid;index" json:"subscriptionId" admin:"ref=subscription"`
+	Seller         string        `gorm:"type:varchar(64);uniqueIndex:idx_invoice_number;not null" json:"seller"`
+	Number         string        `gorm:"type:varchar(32);uniqueIndex:idx_invoice_number;not null" json:"number" admin:"list,search,order=1"`
+	Status         string        `gorm:"type:varchar(16);default:'open'" json:"status" binding:"omitempty,oneof=open paid void" admin:"list"`
+	Currency       string        `gorm:"type:varchar(3);not null" json:"currency"`
+	PeriodStart    time.Time     `json:"periodStart"`
+	PeriodEnd      time.Time     `json:"periodEnd"`
+	Subtotal       int64         `json:"subtotal"`
+	TaxRate        float64       `json:"taxRate"`
+	Tax            int64         `json:"tax"`
+	Total          int64         `json:"total" admin:"list,help=Amount in minor currency units"`
+	IssuedAt       time.Time     `json:"issuedAt" admin:"list"`
+	VoidedAt       *time.Time    `json:"voidedAt"`
+	ReplacesID     *uuid.UUID    `gorm:"type:uuid" json:"replacesId" admin:"ref=invoice"`
+	Lines          []InvoiceLine `gorm:"foreignKey:InvoiceID" json:"lines"`
+}
+
+type InvoiceLine struct {
+	BaseModel
+	InvoiceID   uuid.UUID `gorm:"type:uuid;index;not null" json:"invoiceId"`
+	Description string    `json:"description"`
+	Quantity    int64     `json:"quantity"`
+	UnitAmount  int64     `json:"unitAmount"`
+	Amount      int64     `json:"amount"`
+}
+
+// InvoiceSequence holds the next invoice number of each seller
+type InvoiceSequence struct {
+	Seller string `gorm:"type:varchar(64);primaryKey"`
+	Next   int64  `gorm:"not null;default:1"`
+}
@@ -7,12 +7,13 @@ import (
 )
 
 type Setting struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-	Key       string    `json:"key" gorm:"uniqueIndex;not null"`
-	Value     string    `json:"value"`
-	Category  string    `json:"category" gorm:"default:'general'"`
-	IsPublic  bool      `json:"isPublic" gorm:"default:false"`
+	Versioned
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()" admin:"readonly" query:"true"`
+	CreatedAt time.Time `json:"createdAt" admin:"readonly" query:"true"`
+	UpdatedAt time.Time `json:"updatedAt" admin:"readonly" query:"true"`
+	Key       string    `json:"key" gorm:"uniqueIndex;not null" binding:"required" admin:"list,search,order=1" query:"true"`
+	Value     string    `json:"value" admin:"list,search,widget=textarea" query:"true"`
+	Category  string    `json:"category" gorm:"default:'general'" admin:"list,search" query:"true"`
+	IsPublic  bool      `json:"isPublic" gorm:"default:false" admin:"list,label=Public" query:"true"`
 }
 
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscription is a user's plan and billing state. NextPlanKey is the plan a
+// trial continues on, chosen by checking out during it; trials that end
+// without a checkout revert to the default plan.
+type Subscription struct {
+	BaseModel
+	UserID              uuid.UUID  `gorm:"type:uuid;uniqueIndex;not null" json:"userId" admin:"list,ref=user"`
+	PlanKey             string     `gorm:"type:varchar(32);not null" json:"plan" binding:"plan" admin:"list,label=Plan"`
+	Status              string     `gorm:"type:varchar(16);default:'active';index" json:"status" binding:"omitempty,oneof=trialing active past_due suspended cancelled" admin:"list"`
+	CurrentPeriodStart  time.Time  `json:"currentPeriodStart"`
+	CurrentPeriodEnd    time.Time  `json:"currentPeriodEnd" admin:"list"`
+	TrialEndsAt         *time.Time `json:"trialEndsAt"`
+	NextPlanKey         string     `gorm:"type:varchar(32)" json:"nextPlan" admin:"readonly,label=Plan after trial"`
+	TrialReminderSentAt *time.Time `json:"trialReminderSentAt"`
+	PastDueSince        *time.Time `json:"pastDueSince"`
+	DunningAttempts     int        `gorm:"default:0" json:"dunningAttempts"`
+	NextDunningAt       *time.Time `json:"nextDunningAt"`
+}
+
+// SubscriptionEvent records a subscription status transition for support
+type SubscriptionEvent struct {
+	BaseModel
+	SubscriptionID uuid.UUID `gorm:"type:uuid;index;not null" json:"subscriptionId" admin:"list,ref=subscription"`
+	FromStatus     string    `gorm:"type:varchar(16)" json:"fromStatus" admin:"list"`
+	ToStatus       string    `gorm:"type:varchar(16);not null" json:"toStatus" admin:"list"`
+	Reason         string    `json:"reason" admin:"list,search"`
+}
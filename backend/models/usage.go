@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageEvent is a single metered action, kept for auditing and recalculation
+type UsageEvent struct {
+	BaseModel
+	UserID   uuid.UUID `gorm:"type:uuid;index;not null" json:"userId" admin:"ref=user"`
+	Metric   string    `gorm:"type:varchar(32);index;not null" json:"metric"`
+	Quantity int64     `gorm:"not null" json:"quantity"`
+}
+
+// UsageRecord is the per billing period rollup of usage events
+type UsageRecord struct {
+	BaseModel
+	UserID      uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_usage_period;not null" json:"userId" admin:"ref=user"`
+	Metric      string    `gorm:"type:varchar(32);uniqueIndex:idx_usage_period;not null" json:"metric"`
+	PeriodStart time.Time `gorm:"uniqueIndex:idx_usage_period;not null" json:"periodStart"`
+	PeriodEnd   time.Time `gorm:"not null" json:"periodEnd"`
+	Quantity    int64     `gorm:"not null;default:0" json:"quantity"`
+}
@@ -1,12 +1,20 @@
 package models
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
 type User struct {
 	BaseModel
-	Email        string `gorm:"unique;not null" json:"email" public:"true"`
-	PasswordHash string `gorm:"not null" json:"-" public:"false"`
-	FirstName    string `json:"firstName" public:"true"`
-	LastName     string `json:"lastName" public:"true"`
-	Avatar       string `gorm:"type:text" json:"avatar" public:"true"`
-	IsActive     bool   `gorm:"default:true" json:"isActive" public:"true"`
-	Role         string `gorm:"type:varchar(16);default:'user'" json:"role" public:"true"`
+	Email            string     `gorm:"uniqueIndex:idx_users_live_email,where:deleted_at IS NULL;not null" json:"email" public:"true" binding:"required,email" admin:"list,search,order=1"`
+	PasswordHash     string     `gorm:"not null" json:"-" public:"false"`
+	FirstName        string     `json:"firstName" public:"true" admin:"list,search"`
+	LastName         string     `json:"lastName" public:"true" admin:"list,search"`
+	Avatar           string     `gorm:"type:text" json:"avatar" public:"true" admin:"hidden"`
+	IsActive         bool       `gorm:"default:true" json:"isActive" public:"true" admin:"list,label=Active"`
+	Role             string     `gorm:"type:varchar(16);default:'user'" json:"role" public:"true" binding:"omitempty,oneof=user admin" admin:"list,enum=user|admin"`
+	OrganizationID   *uuid.UUID `gorm:"type:uuid;index" json:"organizationId" public:"true" admin:"label=Organization"`
+	TokensValidAfter *time.Time `json:"tokensValidAfter" public:"false" admin:"readonly,label=Logged out at"`
 }
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Versioned opts a model registered as an admin resource into version
+// history when embedded. Every create, update and delete then stores a
+// snapshot of the record as a RecordVersion.
+type Versioned struct{}
+
+func (Versioned) KeepsVersions() {}
+
+// RecordVersion is a snapshot of a versioned record after a change. Numbers
+// count the versions of a record from 1.
+type RecordVersion struct {
+	ID        uuid.UUID                  `gorm:"type:uuid;primary_key" json:"id"`
+	CreatedAt time.Time                  `json:"createdAt"`
+	Resource  string                     `gorm:"type:varchar(64);uniqueIndex:idx_record_version;not null" json:"resource"`
+	RecordID  string                     `gorm:"type:varchar(64);uniqueIndex:idx_record_version;not null" json:"recordId"`
+	Number    int                        `gorm:"uniqueIndex:idx_record_version;not null" json:"number"`
+	Event     string                     `gorm:"type:varchar(16);not null" json:"event"`
+	RevertOf  *int                       `json:"revertOf"`
+	AuthorID  *uuid.UUID                 `gorm:"type:uuid;index" json:"authorId"`
+	Data      map[string]json.RawMessage `gorm:"type:jsonb;serializer:json" json:"data"`
+}
+
+func (v *RecordVersion) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
@@ -1,20 +1,85 @@
 package resources
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"platform/backend/db"
 	"platform/backend/models"
 	"platform/backend/utils"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// BulkAdminRequest selects records by IDs, or by the list filter and search
+// parameters of the query string when IDs are omitted
+type BulkAdminRequest struct {
+	IDs    []uuid.UUID            `json:"ids"`
+	Action string                 `json:"action" binding:"required,oneof=update delete"`
+	Values map[string]interface{} `json:"values"`
+}
+
 func init() {
-	utils.RegisterAdminResource("user", models.User{}, []string{"list", "view", "edit", "delete"})
+	utils.RegisterAdminResource("user", models.User{}, []string{"list", "view", "edit", "delete", "restore", "purge", "export", "resetPassword", "forceLogout"}, userActions...)
+
+	utils.RegisterAdminResource("setting", models.Setting{}, []string{"list", "view", "edit", "create", "delete", "export", "import"})
+
+	utils.RegisterAdminResource("subscription", models.Subscription{}, []string{"list", "view", "edit", "export", "recalculateUsage"}, subscriptionActions...)
+
+	utils.RegisterAdminResource("subscriptionEvent", models.SubscriptionEvent{}, []string{"list", "view", "export"})
+
+	utils.RegisterAdminResource("usageRecord", models.UsageRecord{}, []string{"list", "view", "export"})
+
+	utils.RegisterAdminResource("invoice", models.Invoice{}, []string{"list", "view", "export", "void", "reissue"}, invoiceActions...)
+
+	utils.RegisterAdminResource("featureFlag", models.FeatureFlag{}, []string{"list", "view", "edit", "create", "delete", "restore", "purge", "export", "import"})
+
+	utils.RegisterAdminResource("coupon", models.Coupon{}, []string{"list", "view", "edit", "create", "delete", "restore", "purge", "export", "import"})
+
+	utils.RegisterAdminResource("promotionCode", models.PromotionCode{}, []string{"list", "view", "edit", "create", "delete", "restore", "purge", "export", "import"})
+
+	utils.RegisterAdminResource("couponRedemption", models.CouponRedemption{}, []string{"list", "view", "export"})
 
-	utils.RegisterAdminResource("setting", models.Setting{}, []string{"list", "view", "edit", "create", "delete"})
+	utils.RegisterAdminResource("auditLog", models.AuditLog{}, []string{"list", "view", "export"})
+
+	// What purging a record does to every table that references it
+	utils.RegisterPurgeReferences(models.User{},
+		utils.PurgeReference{Model: models.Subscription{}, Column: "user_id", Action: utils.PurgeCascade},
+		utils.PurgeReference{Model: models.UsageEvent{}, Column: "user_id", Action: utils.PurgeCascade},
+		utils.PurgeReference{Model: models.UsageRecord{}, Column: "user_id", Action: utils.PurgeCascade},
+		utils.PurgeReference{Model: models.CouponRedemption{}, Column: "user_id", Action: utils.PurgeCascade},
+		utils.PurgeReference{Model: models.Invoice{}, Column: "user_id", Action: utils.PurgeRestrict},
+		utils.PurgeReference{Model: models.AuditLog{}, Column: "actor_id", Action: utils.PurgeKeep},
+		utils.PurgeReference{Model: models.RecordVersion{}, Column: "author_id", Action: utils.PurgeKeep},
+	)
+	utils.RegisterPurgeReferences(models.Subscription{},
+		utils.PurgeReference{Model: models.SubscriptionEvent{}, Column: "subscription_id", Action: utils.PurgeCascade},
+		utils.PurgeReference{Model: models.CouponRedemption{}, Column: "subscription_id", Action: utils.PurgeCascade},
+		utils.PurgeReference{Model: models.Invoice{}, Column: "subscription_id", Action: utils.PurgeRestrict},
+	)
+	utils.RegisterPurgeReferences(models.Coupon{},
+		utils.PurgeReference{Model: models.PromotionCode{}, Column: "coupon_id", Action: utils.PurgeCascade},
+		utils.PurgeReference{Model: models.CouponRedemption{}, Column: "coupon_id", Action: utils.PurgeRestrict},
+	)
+	utils.RegisterPurgeReferences(models.PromotionCode{},
+		utils.PurgeReference{Model: models.CouponRedemption{}, Column: "promotion_code_id", Action: utils.PurgeNullify},
+	)
+	utils.RegisterPurgeReferences(models.FeatureFlag{})
+	utils.RegisterPurgeReferences(models.SubscriptionEvent{})
+	utils.RegisterPurgeReferences(models.UsageEvent{})
+	utils.RegisterPurgeReferences(models.UsageRecord{})
+	utils.RegisterPurgeReferences(models.CouponRedemption{})
+
+	utils.RegisterStatWidget(utils.CountWidget("users", "Users", &models.User{}, "", nil))
+	utils.RegisterStatWidget(utils.SeriesWidget("signups", "Signups", &models.User{}, "", "created_at", nil))
+	utils.RegisterStatWidget(utils.AggregateWidget("activeUsers", "Active users", utils.StatCount,
+		&models.UsageEvent{}, "count(DISTINCT user_id)", "created_at", nil))
 }
 
 func GetAdminResources(c *gin.Context) {
@@ -32,6 +97,11 @@ func GetAdminResources(c *gin.Context) {
 				"fields":        metadata.Fields,
 				"searchFields":  metadata.SearchFields,
 				"displayFields": metadata.DisplayFields,
+				"relations":     metadata.Relations,
+				"actions":       metadata.Actions,
+				"softDelete":    metadata.SoftDelete,
+				"versioned":     metadata.Versioned,
+				"searchMode":    utils.SearchMode(),
 			}
 		}
 
@@ -42,14 +112,109 @@ func GetAdminResources(c *gin.Context) {
 func GetAdminResourceData(c *gin.Context) {
 	utils.H(c, func() {
 		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "list")
 
-		resourceName := c.Param("resource")
-		items := utils.FetchAdminResourceData(resourceName)
-		metadata := utils.GetAdminResource(resourceName)
+		query, err := utils.ParseListQuery(c, reflect.New(metadata.ModelType).Interface(), metadata.Columns())
+		if err != nil {
+			utils.Respond(c, utils.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if query.Trashed != "" && !metadata.SoftDelete {
+			utils.Respond(c, utils.StatusBadRequest, metadata.PluralName+" are deleted permanently and have no trash", nil)
+			return
+		}
 
-		utils.Respond(c, utils.StatusOK, "", gin.H{
-			resourceName + "s": items,
-			"metadata":         metadata,
+		// include names belongs-to relations whose display fields are returned
+		// alongside the page
+		for _, name := range query.Include {
+			if relation := metadata.Relation(name); relation == nil || relation.Kind != utils.RelationBelongsTo {
+				utils.Respond(c, utils.StatusBadRequest, "cannot include "+name, nil)
+				return
+			}
+		}
+
+		items, total := utils.FetchAdminResourceData(metadata.Name, query)
+
+		response := gin.H{
+			metadata.Name + "s": utils.Try(query.Project(items)),
+			"metadata":          metadata,
+			"pagination":        query.Pagination(total),
+			"searchMode":        utils.SearchMode(),
+		}
+		if len(query.Include) > 0 {
+			response["related"] = utils.Try(utils.AdminRelatedLabels(metadata, items, query.Include))
+		}
+
+		utils.Respond(c, utils.StatusOK, "", response)
+	})
+}
+
+// LookupAdminResource returns select box options, either the records named
+// by ids or those matching q
+func LookupAdminResource(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "list")
+
+		var ids []uuid.UUID
+		if raw := c.Query("ids"); raw != "" {
+			for _, value := range strings.Split(raw, ",") {
+				id, err := uuid.Parse(strings.TrimSpace(value))
+				if err != nil {
+					utils.Respond(c, utils.StatusBadRequest, "Invalid id "+value, nil)
+					return
+				}
+				ids = append(ids, id)
+			}
+		}
+
+		options := utils.Try(utils.AdminLookup(metadata, strings.TrimSpace(c.Query("q")), ids))
+
+		utils.Respond(c, utils.StatusOK, "", gin.H{"options": options})
+	})
+}
+
+func GetAdminResourceRecord(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "view")
+		record := fetchAdminRecord(c, metadata)
+
+		utils.SetETag(c, record.Interface())
+		utils.Respond(c, utils.StatusOK, "", gin.H{metadata.Name: record.Interface()})
+	})
+}
+
+func CreateAdminResource(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "create")
+
+		data := *utils.Get(utils.BindAndValidate[map[string]interface{}](c))
+
+		recordPtr := reflect.New(metadata.ModelType)
+		errs := utils.ApplyAdminValues(metadata, recordPtr.Elem(), data)
+		for field, problem := range utils.ValidateAdminRecord(metadata, recordPtr.Elem()) {
+			if _, ok := errs[field]; !ok {
+				errs[field] = problem
+			}
+		}
+		if len(errs) > 0 {
+			utils.FieldErrorsResponse(c, errs)
+			return
+		}
+
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			if err := tx.Create(recordPtr.Interface()).Error; err != nil {
+				return err
+			}
+			return utils.Audit(tx, utils.AuditActorOf(c), "create", metadata.Name, adminRecordID(recordPtr),
+				nil, utils.SnapshotRecord(recordPtr.Interface()))
+		})
+		utils.Check(err == nil)
+
+		utils.Respond(c, utils.StatusCreated, metadata.Name+" created successfully", gin.H{
+			metadata.Name: recordPtr.Interface(),
 		})
 	})
 }
@@ -57,74 +222,375 @@ func GetAdminResourceData(c *gin.Context) {
 func UpdateAdminResource(c *gin.Context) {
 	utils.H(c, func() {
 		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "edit")
+		existingPtr := fetchAdminRecord(c, metadata)
+		utils.CheckIfMatch(c, existingPtr.Interface())
 
-		resourceName := c.Param("resource")
-		id := utils.Try(uuid.Parse(c.Param("id")))
+		// Bind the update request
+		updateData := *utils.Get(utils.BindAndValidate[map[string]interface{}](c))
 
-		metadata := utils.GetAdminResource(resourceName)
-		utils.Check(metadata != nil)
+		before := utils.SnapshotRecord(existingPtr.Interface())
+		if errs := utils.ApplyAdminValues(metadata, existingPtr.Elem(), updateData); len(errs) > 0 {
+			utils.FieldErrorsResponse(c, errs)
+			return
+		}
 
-		// Get the existing record using DRY utility
-		existingPtr := reflect.New(metadata.ModelType)
-		utils.TryErr(utils.FindByIDGeneric(existingPtr.Interface(), id))
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			if err := utils.SaveIfUnchanged(tx, existingPtr.Interface()); err != nil {
+				return err
+			}
+			return utils.Audit(tx, utils.AuditActorOf(c), "update", metadata.Name, adminRecordID(existingPtr),
+				before, utils.SnapshotRecord(existingPtr.Interface()))
+		})
+		utils.Check(err == nil)
 
-		// Bind the update request
-		var updateData map[string]interface{}
-		utils.TryErr(c.ShouldBindJSON(&updateData))
-
-		// Apply updates using reflection
-		existing := existingPtr.Elem()
-		for key, value := range updateData {
-			if key == "id" || key == "createdAt" || key == "updatedAt" || key == "deletedAt" {
-				continue // Skip system fields
-			}
-
-			field := existing.FieldByName(strings.Title(key))
-			if field.IsValid() && field.CanSet() {
-				// Convert value to appropriate type
-				val := reflect.ValueOf(value)
-				if val.Type().ConvertibleTo(field.Type()) {
-					field.Set(val.Convert(field.Type()))
-				} else if field.Kind() == reflect.String && val.Kind() != reflect.String {
-					field.SetString(fmt.Sprint(value))
-				}
+		utils.SetETag(c, existingPtr.Interface())
+		utils.Respond(c, utils.StatusOK, metadata.Name+" updated successfully", gin.H{
+			metadata.Name: existingPtr.Interface(),
+		})
+	})
+}
+
+func DeleteAdminResource(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "delete")
+		recordPtr := fetchAdminRecord(c, metadata)
+		utils.CheckIfMatch(c, recordPtr.Interface())
+		before := utils.SnapshotRecord(recordPtr.Interface())
+
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			if err := utils.DeleteIfUnchanged(tx, recordPtr.Interface()); err != nil {
+				return err
+			}
+			return utils.Audit(tx, utils.AuditActorOf(c), "delete", metadata.Name, adminRecordID(recordPtr), before, nil)
+		})
+		utils.Check(err == nil)
+
+		utils.Respond(c, utils.StatusOK, metadata.Name+" deleted successfully", nil)
+	})
+}
+
+func ExportAdminResource(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "export")
+
+		format := c.DefaultQuery("format", utils.FormatCSV)
+		contentType := utils.ExportContentType(format)
+		if contentType == "" {
+			utils.Respond(c, utils.StatusBadRequest, "format must be csv, json or ndjson", nil)
+			return
+		}
+
+		query, err := utils.ParseListQuery(c, reflect.New(metadata.ModelType).Interface(), metadata.Columns())
+		if err != nil {
+			utils.Respond(c, utils.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, metadata.PluralName, format))
+		c.Status(int(utils.StatusOK))
+
+		// The response has started, so a failure can only end the stream early
+		if err := utils.ExportAdminResource(c.Writer, metadata, query, format); err != nil {
+			log.Printf("Export of %s failed: %v", metadata.PluralName, err)
+		}
+	})
+}
+
+func ImportAdminResource(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "import")
+
+		format := c.Query("format")
+		if format == "" {
+			switch contentType := c.ContentType(); {
+			case strings.Contains(contentType, "csv"):
+				format = utils.FormatCSV
+			case strings.Contains(contentType, "ndjson"):
+				format = utils.FormatNDJSON
+			default:
+				format = utils.FormatJSON
 			}
 		}
 
-		utils.TryErr(utils.SaveGeneric(existingPtr.Interface()))
+		key := c.DefaultQuery("key", "id")
+		keys := utils.Try(metadata.UniqueKeys())
+		if !slices.Contains(keys, key) {
+			utils.Respond(c, utils.StatusBadRequest, "key must be one of "+strings.Join(keys, ", "), nil)
+			return
+		}
 
-		utils.Respond(c, utils.StatusOK, resourceName+" updated successfully", gin.H{
-			resourceName: existingPtr.Interface(),
+		rows, err := utils.ReadAdminImport(c.Request.Body, metadata, format)
+		if err != nil {
+			utils.Respond(c, utils.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		dryRun := c.Query("dryRun") == "true"
+		var report utils.ImportReport
+		err = utils.Transaction(c, func(tx *gorm.DB) error {
+			var err error
+			report, err = utils.ImportAdminRecords(tx, utils.AuditActorOf(c), metadata, rows, key, dryRun)
+			return err
 		})
+		utils.Check(err == nil)
+
+		utils.Respond(c, utils.StatusOK, "", gin.H{"import": report})
 	})
 }
 
-func DeleteAdminResource(c *gin.Context) {
+func BulkAdminResource(c *gin.Context) {
 	utils.H(c, func() {
 		utils.RequireAdmin(c)
+		req := utils.Get(utils.BindAndValidate[BulkAdminRequest](c))
+		metadata := utils.RequireAdminCapability(c, utils.BulkActions[req.Action])
+
+		if req.Action == "update" && len(req.Values) == 0 {
+			utils.Respond(c, utils.StatusBadRequest, "values are required for update", nil)
+			return
+		}
 
-		resourceName := c.Param("resource")
-		id := utils.Try(uuid.Parse(c.Param("id")))
+		ids := req.IDs
+		if len(ids) == 0 {
+			query, err := utils.ParseListQuery(c, reflect.New(metadata.ModelType).Interface(), metadata.Columns())
+			if err != nil {
+				utils.Respond(c, utils.StatusBadRequest, err.Error(), nil)
+				return
+			}
+			if len(query.Filters) == 0 && query.Search == "" {
+				utils.Respond(c, utils.StatusBadRequest, "Select records by ids or a filter", nil)
+				return
+			}
+			ids, err = utils.BulkAdminIDs(db.DB, metadata, query)
+			if err != nil {
+				utils.Respond(c, utils.StatusBadRequest, err.Error(), nil)
+				return
+			}
+		} else if len(ids) > utils.MaxBulkRecords {
+			utils.Respond(c, utils.StatusBadRequest, fmt.Sprintf("At most %d records can be changed at once", utils.MaxBulkRecords), nil)
+			return
+		}
 
-		metadata := utils.GetAdminResource(resourceName)
-		utils.Check(metadata != nil)
+		// Clients that accept NDJSON receive progress lines before the result
+		var progress func(done, total int)
+		streaming := strings.Contains(c.GetHeader("Accept"), "application/x-ndjson")
+		if streaming {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(int(utils.StatusOK))
+			encoder := json.NewEncoder(c.Writer)
+			progress = func(done, total int) {
+				encoder.Encode(gin.H{"progress": gin.H{"done": done, "total": total}})
+				c.Writer.Flush()
+			}
+		}
 
-		// Delete the record using DRY utility
-		recordPtr := reflect.New(metadata.ModelType)
-		utils.TryErr(utils.DeleteByIDGeneric(recordPtr.Interface(), id))
+		var result utils.BulkResult
+		bulk := func(tx *gorm.DB) error {
+			var err error
+			result, err = utils.BulkAdminAction(tx, utils.AuditActorOf(c), metadata, ids, req.Action, req.Values, progress)
+			return err
+		}
+
+		// The status of a stream is sent, so its last line reports a failure
+		if streaming {
+			encoder := json.NewEncoder(c.Writer)
+			if err := utils.RunTransaction(c, bulk); err != nil {
+				encoder.Encode(gin.H{"error": err.Error()})
+				return
+			}
+			encoder.Encode(gin.H{"result": result})
+			return
+		}
+
+		utils.Check(utils.Transaction(c, bulk) == nil)
+		utils.Respond(c, utils.StatusOK, "", gin.H{"bulk": result})
+	})
+}
+
+// RestoreAdminResource moves a soft-deleted record out of the trash, unless a
+// live record has taken one of its unique values
+func RestoreAdminResource(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "restore")
+		id := utils.Get(utils.ParseUUID(c, "id", metadata.Name))
+
+		recordPtr, trashed, err := utils.FindAdminRecord(metadata, id)
+		if err != nil || !trashed {
+			utils.NotFoundResponse(c, strings.Title(metadata.Name)+" not found in trash")
+			return
+		}
+
+		err = utils.Transaction(c, func(tx *gorm.DB) error {
+			conflicts, err := utils.RestoreConflicts(tx, metadata, recordPtr.Interface())
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				return utils.NewHTTPError(utils.StatusConflict, "Another "+metadata.Name+" has the same "+
+					strings.Join(conflicts, ", ")+", change it before restoring this one")
+			}
+
+			if err := tx.Unscoped().Model(recordPtr.Interface()).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.First(recordPtr.Interface(), "id = ?", id).Error; err != nil {
+				return err
+			}
+			return utils.Audit(tx, utils.AuditActorOf(c), "restore", metadata.Name, id.String(),
+				nil, utils.SnapshotRecord(recordPtr.Interface()))
+		})
+		utils.Check(err == nil)
+
+		utils.Respond(c, utils.StatusOK, metadata.Name+" restored successfully", gin.H{
+			metadata.Name: recordPtr.Interface(),
+		})
+	})
+}
+
+// PurgeAdminResource permanently deletes a record, live or in the trash,
+// applying the purge references to it, unless one of them restricts it
+func PurgeAdminResource(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "purge")
+		id := utils.Get(utils.ParseUUID(c, "id", metadata.Name))
+
+		recordPtr, _, err := utils.FindAdminRecord(metadata, id)
+		if err != nil {
+			utils.NotFoundResponse(c, strings.Title(metadata.Name)+" not found")
+			return
+		}
+
+		err = utils.Transaction(c, func(tx *gorm.DB) error {
+			blockers, err := utils.PurgeBlockers(tx, metadata.ModelType, id)
+			if err != nil {
+				return err
+			}
+			if len(blockers) > 0 {
+				return utils.NewHTTPError(utils.StatusConflict, strings.Title(metadata.Name)+" is still referenced by "+
+					strings.Join(blockers, ", ")+" and cannot be deleted permanently")
+			}
 
-		utils.Respond(c, utils.StatusOK, resourceName+" deleted successfully", nil)
+			if err := utils.PurgeRecords(tx, metadata.ModelType, id); err != nil {
+				return err
+			}
+			return utils.Audit(tx, utils.AuditActorOf(c), "purge", metadata.Name, id.String(),
+				utils.SnapshotRecord(recordPtr.Interface()), nil)
+		})
+		utils.Check(err == nil)
+
+		utils.Respond(c, utils.StatusOK, metadata.Name+" deleted permanently", nil)
 	})
 }
 
+// RunAdminAction runs a custom action of the resource on the record named by
+// :id. The optional JSON body holds the action's input. The change and the
+// result are audited in the transaction that runs the action.
+func RunAdminAction(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireAdminCapability(c, "view")
+		action := metadata.Action(c.Param("action"))
+		if action == nil {
+			utils.NotFoundResponse(c, "Unknown action "+c.Param("action")+" of "+metadata.Name)
+			return
+		}
+		utils.RequireResourceCapability(c, metadata.Name, action.Capability)
+		recordPtr := fetchAdminRecord(c, metadata)
+
+		var data map[string]interface{}
+		if err := json.NewDecoder(c.Request.Body).Decode(&data); err != nil && err != io.EOF {
+			utils.Respond(c, utils.StatusBadRequest, "Invalid action input: "+err.Error(), nil)
+			return
+		}
+		input, errs := action.ParseInput(data)
+		if len(errs) > 0 {
+			utils.FieldErrorsResponse(c, errs)
+			return
+		}
+
+		before := utils.SnapshotRecord(recordPtr.Interface())
+		var result any
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			var err error
+			result, err = action.Handler(c, tx, recordPtr.Interface(), input)
+			if err != nil {
+				return err
+			}
+			return utils.AuditAction(tx, utils.AuditActorOf(c), action.Name, metadata.Name, adminRecordID(recordPtr),
+				before, utils.SnapshotRecord(recordPtr.Interface()), result)
+		})
+		utils.Check(err == nil)
+
+		utils.Respond(c, utils.StatusOK, action.Label+" completed", gin.H{
+			metadata.Name: recordPtr.Interface(),
+			"result":      result,
+		})
+	})
+}
+
+// adminRecordID returns the ID of a record loaded through its metadata
+func adminRecordID(recordPtr reflect.Value) string {
+	return fmt.Sprint(recordPtr.Elem().FieldByName("ID").Interface())
+}
+
+// fetchAdminRecord loads the record named by the :id parameter
+func fetchAdminRecord(c *gin.Context, metadata *utils.ResourceMetadata) reflect.Value {
+	id := utils.Get(utils.ParseUUID(c, "id", metadata.Name))
+
+	recordPtr := reflect.New(metadata.ModelType)
+	if err := utils.FindByIDGeneric(recordPtr.Interface(), id); err != nil {
+		utils.NotFoundResponse(c, strings.Title(metadata.Name)+" not found")
+		utils.Abort()
+	}
+	return recordPtr
+}
+
+// GetAdminStats returns the current value of every widget that does not
+// depend on a date range
 func GetAdminStats(c *gin.Context) {
 	utils.H(c, func() {
 		utils.RequireAdmin(c)
 
+		stats := gin.H{}
+		for _, widget := range utils.StatWidgets() {
+			if !widget.Ranged && widget.Kind != utils.StatSeries {
+				stats[widget.Key] = utils.Try(utils.ComputeStat(widget, utils.StatRange{})).Value
+			}
+		}
+
+		utils.Respond(c, utils.StatusOK, "", gin.H{
+			"stats":   stats,
+			"widgets": utils.StatWidgets(),
+		})
+	})
+}
+
+func GetAdminStat(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+
+		widget, ok := utils.GetStatWidget(c.Param("widget"))
+		if !ok {
+			utils.NotFoundResponse(c, "Unknown statistic "+c.Param("widget"))
+			return
+		}
+
+		r, err := utils.ParseStatRange(c)
+		if err != nil {
+			utils.Respond(c, utils.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
 		utils.Respond(c, utils.StatusOK, "", gin.H{
-			"stats": gin.H{
-				"users": utils.CountAdminResource("user"),
-			},
+			"widget": widget,
+			"range":  r,
+			"stat":   utils.Try(utils.ComputeStat(widget, r)),
 		})
 	})
 }
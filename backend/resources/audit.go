@@ -0,0 +1,30 @@
+package resources
+
+import (
+	"platform/backend/models"
+	"platform/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAuditLog lists audit log entries, newest first, filtered like admin
+// resource lists, e.g. filter[actorId]=...&filter[createdAt][gte]=...
+func GetAuditLog(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := utils.RequireResourceCapability(c, "auditLog", "list")
+
+		query, err := utils.ParseListQuery(c, &models.AuditLog{}, metadata.Columns())
+		if err != nil {
+			utils.Respond(c, utils.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		entries, total := utils.FetchAdminResourceData(metadata.Name, query)
+
+		utils.Respond(c, utils.StatusOK, "", gin.H{
+			"entries":    utils.Try(query.Project(entries)),
+			"pagination": query.Pagination(total),
+		})
+	})
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type RegisterRequest struct {
@@ -38,7 +39,15 @@ func Register(c *gin.Context) {
 			Role:         config.RoleUser,
 		}
 
-		utils.TryErr(utils.HandleCRUD(c, "create", &user, "user"))
+		// A user never exists without a subscription
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			_, err := utils.StartSubscription(tx, user.ID)
+			return err
+		})
+		utils.Check(err == nil)
 		token := utils.Try(utils.GenerateToken(user.ID))
 
 		utils.Respond(c, utils.StatusCreated, "User registered successfully", gin.H{
@@ -1,6 +1,7 @@
 package resources
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -38,6 +39,13 @@ func UploadAvatar(c *gin.Context) {
 
 		avatarURL := fmt.Sprintf("data:%s;base64,%s", contentType, utils.EncodeBase64(fileBytes))
 
+		err = utils.CheckStorageQuota(userID, int64(len(avatarURL)))
+		if errors.Is(err, utils.ErrQuotaExceeded) {
+			utils.Respond(c, utils.StatusTooManyRequests, err.Error(), nil)
+			return
+		}
+		utils.TryErr(err)
+
 		_, err = avatarService.UpdateUserAvatar(userID, avatarURL)
 		utils.TryErr(err)
 
@@ -0,0 +1,55 @@
+package resources
+
+import (
+	"platform/backend/config"
+	"platform/backend/models"
+	"platform/backend/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var subscriptionActions = []utils.AdminAction{
+	{
+		Name:    "recalculateUsage",
+		Label:   "Recalculate usage",
+		Confirm: "Rebuild the usage of the current period from the recorded usage events?",
+		Handler: recalculateUsage,
+	},
+}
+
+func recalculateUsage(c *gin.Context, tx *gorm.DB, record any, input any) (any, error) {
+	usage, err := utils.RecalculateUsage(tx, *record.(*models.Subscription))
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"usage": usage}, nil
+}
+
+func init() {
+	paid := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("status = ?", config.InvoiceStatusPaid)
+	}
+	utils.RegisterStatWidget(utils.SumWidget("revenue", "Revenue", &models.Invoice{}, "total", "issued_at", paid))
+	utils.RegisterStatWidget(utils.SeriesWidget("revenueSeries", "Revenue over time", &models.Invoice{}, "total", "issued_at", paid))
+	utils.RegisterStatWidget(utils.CountWidget("activeSubscriptions", "Active subscriptions", &models.Subscription{}, "",
+		func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("status IN ?", []string{config.StatusActive, config.StatusTrialing, config.StatusPastDue})
+		}))
+}
+
+func GetUsage(c *gin.Context) {
+	utils.H(c, func() {
+		userID := utils.RequireAuth(c)
+		sub := utils.Try(utils.CurrentSubscription(userID))
+		start, end := utils.BillingPeriod(sub, time.Now().UTC())
+
+		utils.Respond(c, utils.StatusOK, "", gin.H{
+			"plan":        config.GetPlan(sub.PlanKey).Key,
+			"periodStart": start,
+			"periodEnd":   end,
+			"usage":       utils.Try(utils.UsageSummary(sub)),
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package resources
+
+import (
+	"errors"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/db"
+	"platform/backend/models"
+	"platform/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CheckoutRequest struct {
+	Plan          string `json:"plan" binding:"required"`
+	PromotionCode string `json:"promotionCode"`
+}
+
+type ValidatePromotionCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+	Plan string `json:"plan"`
+}
+
+// Checkout changes the plan of the user's subscription and redeems a
+// promotion code, which discounts the upgrade. Upgrades are invoiced and
+// charged before the response; a failed payment puts the subscription past
+// due like any other invoice.
+func Checkout(c *gin.Context) {
+	utils.H(c, func() {
+		req := utils.Get(utils.BindAndValidate[CheckoutRequest](c))
+		userID := utils.RequireAuth(c)
+
+		if _, ok := config.Plans[req.Plan]; !ok {
+			utils.Respond(c, utils.StatusBadRequest, "Unknown plan "+req.Plan, nil)
+			return
+		}
+
+		user := utils.Try(utils.ByID[models.User](userID))
+		sub := utils.Try(utils.CurrentSubscription(userID))
+
+		if req.PromotionCode != "" {
+			utils.Get(requireValidPromotionCode(c, req.PromotionCode, req.Plan, user))
+		}
+
+		var redemption *models.CouponRedemption
+		var invoiceID uuid.UUID
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sub, "id = ?", sub.ID).Error; err != nil {
+				return err
+			}
+			if !utils.CanChangePlan(sub) {
+				return utils.NewHTTPError(utils.StatusConflict, "Settle your outstanding invoices before checking out")
+			}
+
+			var err error
+			redemption, invoiceID, err = utils.CheckoutPlan(tx, &sub, user, req.Plan, req.PromotionCode, time.Now().UTC())
+			if errors.Is(err, utils.ErrInvalidPromotionCode) {
+				return utils.NewHTTPError(utils.StatusBadRequest, err.Error())
+			}
+			return err
+		})
+		utils.Check(err == nil)
+
+		message := "Checkout completed"
+		var invoice *models.Invoice
+		if invoiceID != uuid.Nil {
+			utils.TryErr(utils.ChargeInvoice(invoiceID))
+			charged := utils.Try(utils.ByID[models.Invoice](invoiceID))
+			invoice = &charged
+			sub = utils.Try(utils.ByID[models.Subscription](sub.ID))
+			if invoice.Status != config.InvoiceStatusPaid {
+				message = "Checkout completed, but the payment failed. Please settle invoice " + invoice.Number
+			}
+		}
+
+		utils.Respond(c, utils.StatusOK, message, gin.H{
+			"subscription": sub,
+			"invoice":      invoice,
+			"redemption":   redemption,
+		})
+	})
+}
+
+func ValidatePromotionCode(c *gin.Context) {
+	utils.H(c, func() {
+		req := utils.Get(utils.BindAndValidate[ValidatePromotionCodeRequest](c))
+		userID := utils.RequireAuth(c)
+
+		user := utils.Try(utils.ByID[models.User](userID))
+		plan := req.Plan
+		if plan == "" {
+			plan = utils.Try(utils.CurrentSubscription(userID)).PlanKey
+		}
+
+		coupon := utils.Get(requireValidPromotionCode(c, req.Code, plan, user))
+		utils.Respond(c, utils.StatusOK, "Promotion code is valid", gin.H{"coupon": coupon})
+	})
+}
+
+func requireValidPromotionCode(c *gin.Context, code, plan string, user models.User) (models.Coupon, bool) {
+	_, coupon, err := utils.ValidatePromotionCode(db.DB, code, plan, user)
+	if errors.Is(err, utils.ErrInvalidPromotionCode) {
+		utils.Respond(c, utils.StatusBadRequest, err.Error(), nil)
+		return coupon, false
+	}
+	utils.TryErr(err)
+	return coupon, true
+}
@@ -0,0 +1,15 @@
+package resources
+
+import (
+	"platform/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetFlags(c *gin.Context) {
+	utils.H(c, func() {
+		utils.Respond(c, utils.StatusOK, "", gin.H{
+			"flags": utils.Try(utils.EvaluateFlags(c)),
+		})
+	})
+}
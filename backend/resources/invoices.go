@@ -0,0 +1,75 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"platform/backend/db"
+	"platform/backend/models"
+	"platform/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func ListInvoices(c *gin.Context) {
+	utils.H(c, func() {
+		userID := utils.RequireAuth(c)
+
+		var invoices []models.Invoice
+		utils.TryErr(db.DB.Preload("Lines").Where("user_id = ?", userID).Order("issued_at DESC").Find(&invoices).Error)
+
+		utils.Respond(c, utils.StatusOK, "", gin.H{"invoices": invoices})
+	})
+}
+
+func GetInvoicePDF(c *gin.Context) {
+	utils.H(c, func() {
+		userID := utils.RequireAuth(c)
+		id := utils.Get(utils.ParseUUID(c, "id", "invoice"))
+
+		var invoice models.Invoice
+		err := db.DB.Preload("Lines").Where("id = ? AND user_id = ?", id, userID).First(&invoice).Error
+		if err != nil {
+			utils.NotFoundResponse(c, "Invoice not found")
+			return
+		}
+
+		customer := utils.Try(utils.ByID[models.User](userID))
+
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.Number))
+		c.Data(int(utils.StatusOK), "application/pdf", utils.RenderInvoicePDF(invoice, customer))
+	})
+}
+
+var invoiceActions = []utils.AdminAction{
+	{
+		Name:    "void",
+		Confirm: "Void this invoice? It will no longer be payable.",
+		Handler: voidInvoice,
+	},
+	{
+		Name:    "reissue",
+		Confirm: "Void this invoice and issue a replacement under a new number?",
+		Handler: reissueInvoice,
+	},
+}
+
+func voidInvoice(c *gin.Context, tx *gorm.DB, record any, input any) (any, error) {
+	return nil, invoiceActionError(utils.VoidInvoice(tx, record.(*models.Invoice)))
+}
+
+// reissueInvoice returns the replacement, whose ID the audit log records
+func reissueInvoice(c *gin.Context, tx *gorm.DB, record any, input any) (any, error) {
+	replacement, err := utils.ReissueInvoice(tx, record.(*models.Invoice))
+	if err != nil {
+		return nil, invoiceActionError(err)
+	}
+	return gin.H{"invoice": replacement}, nil
+}
+
+func invoiceActionError(err error) error {
+	if errors.Is(err, utils.ErrInvoiceVoid) || errors.Is(err, utils.ErrInvoicePaid) {
+		return utils.NewHTTPError(utils.StatusConflict, err.Error())
+	}
+	return err
+}
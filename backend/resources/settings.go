@@ -1,11 +1,13 @@
 package resources
 
 import (
+	"platform/backend/config"
 	"platform/backend/models"
 	"platform/backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type CreateSettingRequest struct {
@@ -30,9 +32,39 @@ func createSettingFactory(req *CreateSettingRequest, userID uuid.UUID) *models.S
 	}
 }
 
+// Settings are site wide, so only admins manage them through the generic
+// handlers, whose changes are audited; GetPublicSettings serves the public
+// ones to everybody
 var SettingHandlers = utils.Crud[models.Setting, CreateSettingRequest, UpdateSettingRequest](
 	"setting",
 	createSettingFactory,
+	utils.CrudOptions[models.Setting]{
+		Permissions: map[string]string{
+			"list":   config.RoleAdmin,
+			"get":    config.RoleAdmin,
+			"create": config.RoleAdmin,
+			"update": config.RoleAdmin,
+			"delete": config.RoleAdmin,
+		},
+		BeforeCreate: func(c *gin.Context, setting *models.Setting) error {
+			if utils.ExistsByIn[models.Setting](utils.CrudTx(c), "key", setting.Key) {
+				return utils.NewHTTPError(utils.StatusConflict, "Setting "+setting.Key+" already exists")
+			}
+			return nil
+		},
+		AfterCreate: func(c *gin.Context, setting *models.Setting) error {
+			return utils.Audit(utils.CrudTx(c), utils.AuditActorOf(c), "create", "setting", setting.ID.String(),
+				nil, utils.SnapshotRecord(setting))
+		},
+		AfterUpdate: func(c *gin.Context, old, setting *models.Setting) error {
+			return utils.Audit(utils.CrudTx(c), utils.AuditActorOf(c), "update", "setting", setting.ID.String(),
+				utils.SnapshotRecord(old), utils.SnapshotRecord(setting))
+		},
+		AfterDelete: func(c *gin.Context, setting *models.Setting) error {
+			return utils.Audit(utils.CrudTx(c), utils.AuditActorOf(c), "delete", "setting", setting.ID.String(),
+				utils.SnapshotRecord(setting), nil)
+		},
+	},
 )
 
 func GetPublicSettings(c *gin.Context) {
@@ -76,22 +108,39 @@ func UpdateSettings(c *gin.Context) {
 		var req map[string]string
 		utils.TryErr(c.ShouldBindJSON(&req))
 
-		for key, value := range req {
-			setting, err := utils.Where[models.Setting]("key", key)
-			
-			if err != nil {
-				setting = models.Setting{
-					Key:      key,
-					Value:    value,
-					Category: "general",
-					IsPublic: true,
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			for key, value := range req {
+				var setting models.Setting
+				var before utils.AuditSnapshot
+				action := "update"
+
+				err := tx.Where("key = ?", key).First(&setting).Error
+				if err != nil {
+					action = "create"
+					setting = models.Setting{
+						Key:      key,
+						Value:    value,
+						Category: "general",
+						IsPublic: true,
+					}
+					err = tx.Create(&setting).Error
+				} else {
+					before = utils.SnapshotRecord(setting)
+					setting.Value = value
+					err = tx.Save(&setting).Error
+				}
+				if err != nil {
+					return err
+				}
+
+				err = utils.Audit(tx, utils.AuditActorOf(c), action, "setting", setting.ID.String(), before, utils.SnapshotRecord(setting))
+				if err != nil {
+					return err
 				}
-				utils.TryErr(utils.Create(&setting))
-			} else {
-				setting.Value = value
-				utils.TryErr(utils.Save(&setting))
 			}
-		}
+			return nil
+		})
+		utils.Check(err == nil)
 
 		utils.Respond(c, utils.StatusOK, "Settings updated successfully", nil)
 	})
@@ -1,11 +1,15 @@
 package resources
 
 import (
+	"log"
+	"time"
+
 	"platform/backend/fields"
 	"platform/backend/models"
 	"platform/backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type UpdateUserRequest struct {
@@ -14,6 +18,28 @@ type UpdateUserRequest struct {
 	Email     fields.Email
 }
 
+// ResetPasswordInput is the form of the resetPassword admin action
+type ResetPasswordInput struct {
+	Password string `json:"password" binding:"required,min=8" admin:"widget=password,label=New password"`
+	Notify   bool   `json:"notify" admin:"label=Email the user"`
+}
+
+var userActions = []utils.AdminAction{
+	{
+		Name:    "resetPassword",
+		Label:   "Reset password",
+		Confirm: "Set a new password and log the user out of every session?",
+		Input:   ResetPasswordInput{},
+		Handler: resetUserPassword,
+	},
+	{
+		Name:    "forceLogout",
+		Label:   "Force logout",
+		Confirm: "Log the user out of every session?",
+		Handler: forceUserLogout,
+	},
+}
+
 func GetCurrentUser(c *gin.Context) {
 	utils.H(c, func() {
 		userID := utils.GetCurrentUserID(c)
@@ -27,6 +53,7 @@ func UpdateCurrentUser(c *gin.Context) {
 		req := utils.Get(utils.BindAndValidate[UpdateUserRequest](c))
 		userID := utils.GetCurrentUserID(c)
 		user := utils.Try(utils.ByID[models.User](userID))
+		before := utils.SnapshotRecord(user)
 		
 		values := utils.ExtractFieldValues(req)
 		if email, ok := values["Email"].(string); ok && email != "" && email != user.Email {
@@ -36,7 +63,13 @@ func UpdateCurrentUser(c *gin.Context) {
 		
 		utils.AutoUpdate(&user, req)
 		
-		utils.TryErr(utils.HandleCRUD(c, "update", &user, "user"))
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			return utils.Audit(tx, utils.AuditActorOf(c), "update", "user", user.ID.String(), before, utils.SnapshotRecord(user))
+		})
+		utils.Check(err == nil)
 		utils.CrudSuccess(c, "update", "user", utils.ToPublicJSON(user))
 	})
 }
@@ -45,8 +78,55 @@ func DeleteCurrentUser(c *gin.Context) {
 	utils.H(c, func() {
 		userID := utils.GetCurrentUserID(c)
 		user := utils.Try(utils.ByID[models.User](userID))
-		utils.TryErr(utils.HandleCRUD(c, "delete", &user, "user"))
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			if err := tx.Delete(&user).Error; err != nil {
+				return err
+			}
+			return utils.Audit(tx, utils.AuditActorOf(c), "delete", "user", user.ID.String(), utils.SnapshotRecord(user), nil)
+		})
+		utils.Check(err == nil)
 		utils.CrudSuccess(c, "delete", "user", nil)
 	})
 }
 
+func resetUserPassword(c *gin.Context, tx *gorm.DB, record any, input any) (any, error) {
+	user, req := record.(*models.User), input.(*ResetPasswordInput)
+
+	hash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	user.PasswordHash = hash
+	user.TokensValidAfter = &now
+	if err := tx.Model(user).Select("password_hash", "tokens_valid_after").Updates(user).Error; err != nil {
+		return nil, err
+	}
+
+	utils.AfterCommit(tx, func() {
+		utils.ForgetTokensValidAfter(user.ID)
+		if !req.Notify {
+			return
+		}
+		err := utils.SendMail(user.Email, "Your password was reset",
+			"An administrator has reset the password of your account. Please sign in with the new password you were given.")
+		if err != nil {
+			log.Printf("Failed to notify %s of a password reset: %v", user.Email, err)
+		}
+	})
+	return gin.H{"notified": req.Notify}, nil
+}
+
+func forceUserLogout(c *gin.Context, tx *gorm.DB, record any, input any) (any, error) {
+	user := record.(*models.User)
+
+	now := time.Now().UTC()
+	user.TokensValidAfter = &now
+	if err := tx.Model(user).Update("tokens_valid_after", now).Error; err != nil {
+		return nil, err
+	}
+	utils.AfterCommit(tx, func() {
+		utils.ForgetTokensValidAfter(user.ID)
+	})
+	return nil, nil
+}
@@ -0,0 +1,128 @@
+package resources
+
+import (
+	"strconv"
+
+	"platform/backend/models"
+	"platform/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListRecordVersions lists the versions of a record, newest first
+func ListRecordVersions(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := requireVersioned(c, "view")
+		id := utils.Get(utils.ParseUUID(c, "id", metadata.Name))
+
+		query, err := utils.ParseListQuery(c, nil, nil)
+		if err != nil {
+			utils.Respond(c, utils.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		versions, total, err := utils.ListVersions(metadata, id.String(), query)
+		utils.TryErr(err)
+
+		utils.Respond(c, utils.StatusOK, "", gin.H{
+			"versions":   versions,
+			"pagination": query.Pagination(total),
+		})
+	})
+}
+
+func GetRecordVersion(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := requireVersioned(c, "view")
+		version := fetchRecordVersion(c, metadata, c.Param("version"))
+
+		utils.Respond(c, utils.StatusOK, "", gin.H{"version": version})
+	})
+}
+
+// DiffRecordVersions compares the versions numbered by the from and to
+// parameters field by field. to defaults to the latest version and from to
+// the one before it.
+func DiffRecordVersions(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := requireVersioned(c, "view")
+
+		to := fetchRecordVersion(c, metadata, c.DefaultQuery("to", "0"))
+		fromParam := c.Query("from")
+		if fromParam == "" {
+			fromParam = strconv.Itoa(max(to.Number-1, 1))
+		}
+		from := fetchRecordVersion(c, metadata, fromParam)
+
+		utils.Respond(c, utils.StatusOK, "", gin.H{
+			"from":    from.Number,
+			"to":      to.Number,
+			"changes": utils.DiffVersions(from, to),
+		})
+	})
+}
+
+// RevertRecordVersion restores the editable fields of a record to a version.
+// The revert is itself stored as the newest version.
+func RevertRecordVersion(c *gin.Context) {
+	utils.H(c, func() {
+		utils.RequireAdmin(c)
+		metadata := requireVersioned(c, "edit")
+		recordPtr := fetchAdminRecord(c, metadata)
+		version := fetchRecordVersion(c, metadata, c.Param("version"))
+
+		before := utils.SnapshotRecord(recordPtr.Interface())
+		var errs utils.FieldErrors
+		err := utils.Transaction(c, func(tx *gorm.DB) error {
+			var err error
+			errs, err = utils.RevertToVersion(tx, metadata, recordPtr, version)
+			if err != nil || len(errs) > 0 {
+				return err
+			}
+			return utils.Audit(tx, utils.AuditActorOf(c), "revert", metadata.Name, adminRecordID(recordPtr),
+				before, utils.SnapshotRecord(recordPtr.Interface()))
+		})
+		utils.Check(err == nil)
+		if len(errs) > 0 {
+			utils.FieldErrorsResponse(c, errs)
+			return
+		}
+
+		utils.Respond(c, utils.StatusOK, metadata.Name+" reverted to version "+strconv.Itoa(version.Number), gin.H{
+			metadata.Name: recordPtr.Interface(),
+		})
+	})
+}
+
+// requireVersioned returns the resource named by the :resource parameter,
+// responding 404 unless it keeps versions
+func requireVersioned(c *gin.Context, capability string) *utils.ResourceMetadata {
+	metadata := utils.RequireAdminCapability(c, capability)
+	if !metadata.Versioned {
+		utils.NotFoundResponse(c, metadata.PluralName+" have no version history")
+		utils.Abort()
+	}
+	return metadata
+}
+
+// fetchRecordVersion loads the version numbered by number, where "0" is the
+// latest version, of the record named by the :id parameter
+func fetchRecordVersion(c *gin.Context, metadata *utils.ResourceMetadata, number string) (version models.RecordVersion) {
+	id := utils.Get(utils.ParseUUID(c, "id", metadata.Name))
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		utils.Respond(c, utils.StatusBadRequest, "Invalid version "+number, nil)
+		utils.Abort()
+	}
+
+	version, err = utils.GetVersion(metadata, id.String(), n)
+	if err != nil {
+		utils.NotFoundResponse(c, "Version not found")
+		utils.Abort()
+	}
+	return version
+}
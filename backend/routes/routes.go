@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"platform/backend/config"
 	"platform/backend/controllers"
 	"platform/backend/middleware"
 	"platform/backend/resources"
@@ -15,7 +16,12 @@ func SetupRoutes(r *gin.Engine) {
 	v1 := r.Group("/api/v1")
 	{
 
-		v1.GET("/settings/public", resources.GetPublicSettings)
+		// Every page load fetches the public settings
+		v1.GET("/settings/public",
+			middleware.CacheControl("public, max-age=60"),
+			middleware.Conditional(),
+			middleware.CacheResponses("settings"),
+			resources.GetPublicSettings)
 
 		auth := v1.Group("/auth")
 		{
@@ -24,8 +30,21 @@ func SetupRoutes(r *gin.Engine) {
 			auth.POST("/refresh", resources.RefreshToken)
 		}
 
+		// Billing stays reachable for suspended subscriptions so users can
+		// review and settle their invoices
+		billing := v1.Group("/billing")
+		billing.Use(middleware.AuthRequired())
+		{
+			billing.GET("/usage", resources.GetUsage)
+			billing.GET("/invoices", resources.ListInvoices)
+			billing.GET("/invoices/:id/pdf", resources.GetInvoicePDF)
+			billing.POST("/checkout", resources.Checkout)
+			billing.POST("/promotion-codes/validate", resources.ValidatePromotionCode)
+		}
+
 		protected := v1.Group("/")
 		protected.Use(middleware.AuthRequired())
+		protected.Use(middleware.Quota(config.MetricAPICalls))
 		{
 			users := protected.Group("/users")
 			{
@@ -33,10 +52,12 @@ func SetupRoutes(r *gin.Engine) {
 				users.PUT("/me", resources.UpdateCurrentUser)
 				users.DELETE("/me", resources.DeleteCurrentUser)
 				users.POST("/me/avatar", resources.UploadAvatar)
-				users.POST("/me/avatar/generate", resources.GenerateAvatar)
+				users.POST("/me/avatar/generate", middleware.Quota(config.MetricAIRequests), resources.GenerateAvatar)
 				users.DELETE("/me/avatar", resources.DeleteAvatar)
 			}
 
+			protected.GET("/flags", resources.GetFlags)
+
 			utils.Route(protected, "/settings", resources.SettingHandlers)
 
 			protected.GET("/settings/all", resources.GetAllSettings)
@@ -46,9 +67,24 @@ func SetupRoutes(r *gin.Engine) {
 			{
 				admin.GET("/resources", resources.GetAdminResources)
 				admin.GET("/resources/:resource", resources.GetAdminResourceData)
+				admin.POST("/resources/:resource", resources.CreateAdminResource)
+				admin.GET("/resources/:resource/export", resources.ExportAdminResource)
+				admin.GET("/resources/:resource/lookup", resources.LookupAdminResource)
+				admin.POST("/resources/:resource/import", resources.ImportAdminResource)
+				admin.POST("/resources/:resource/bulk", resources.BulkAdminResource)
+				admin.GET("/resources/:resource/:id", resources.GetAdminResourceRecord)
 				admin.PUT("/resources/:resource/:id", resources.UpdateAdminResource)
 				admin.DELETE("/resources/:resource/:id", resources.DeleteAdminResource)
+				admin.POST("/resources/:resource/:id/restore", resources.RestoreAdminResource)
+				admin.POST("/resources/:resource/:id/purge", resources.PurgeAdminResource)
+				admin.POST("/resources/:resource/:id/actions/:action", resources.RunAdminAction)
+				admin.GET("/resources/:resource/:id/versions", resources.ListRecordVersions)
+				admin.GET("/resources/:resource/:id/versions/diff", resources.DiffRecordVersions)
+				admin.GET("/resources/:resource/:id/versions/:version", resources.GetRecordVersion)
+				admin.POST("/resources/:resource/:id/versions/:version/revert", resources.RevertRecordVersion)
+				admin.GET("/audit", resources.GetAuditLog)
 				admin.GET("/stats", resources.GetAdminStats)
+				admin.GET("/stats/:widget", resources.GetAdminStat)
 			}
 		}
 	}
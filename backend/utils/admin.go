@@ -1,10 +1,20 @@
 package utils
 
 import (
+	"fmt"
+	"log"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"platform/backend/config"
 	"platform/backend/db"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 type ResourceMetadata struct {
@@ -15,25 +25,62 @@ type ResourceMetadata struct {
 	Capabilities  []string
 	SearchFields  []string
 	DisplayFields []string
+	Relations     []RelationMetadata
+	Actions       []AdminAction
+	SoftDelete    bool
+	Versioned     bool
 }
 
+// FieldMetadata describes a model field to the admin. It is built from the
+// field's json, gorm and binding tags and its admin tag, a comma separated
+// list of:
+//
+//	label=Text   label shown instead of the one derived from the field name
+//	help=Text    help text shown with the input; it cannot contain commas
+//	readonly     shown but never changed through the admin
+//	hidden       left out of lists and forms
+//	list         shown as a column of the resource list
+//	search       matched by list search
+//	widget=name  input widget, e.g. textarea; derived from the type otherwise
+//	enum=a|b     allowed values, defaulting to a oneof binding rule or the
+//	             keys of config.Plans for a plan rule
+//	order=3      position among the fields, before fields without an order
+//	ref=user     the admin resource a foreign key field references
 type FieldMetadata struct {
-	Name     string
-	Type     string
-	Label    string
-	Required bool
-	Editable bool
+	Name       string
+	Type       string
+	Label      string
+	Help       string
+	Widget     string
+	Required   bool
+	Editable   bool
+	Hidden     bool
+	Order      int
+	Options    []string
+	Ref        string
+	List       bool   `json:"-"`
+	Search     bool   `json:"-"`
+	Private    bool   `json:"-"`
+	Column     string `json:"-"`
+	Index      []int  `json:"-"`
+	Validation string `json:"-"`
 }
 
 var adminResources = make(map[string]*ResourceMetadata)
 
-func RegisterAdminResource(name string, model interface{}, capabilities []string) *ResourceMetadata {
+// RegisterAdminResource exposes model to the admin under name. actions are
+// the resource's custom actions, which answer 403 unless capabilities
+// include theirs.
+func RegisterAdminResource(name string, model interface{}, capabilities []string, actions ...AdminAction) *ResourceMetadata {
 	modelType := reflect.TypeOf(model)
 	if modelType.Kind() == reflect.Ptr {
 		modelType = modelType.Elem()
 	}
 
-	fields := extractFields(modelType)
+	fields := extractFields(modelType, nil)
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].Order > 0 && (fields[j].Order == 0 || fields[i].Order < fields[j].Order)
+	})
 	
 	metadata := &ResourceMetadata{
 		Name:          name,
@@ -43,31 +90,170 @@ func RegisterAdminResource(name string, model interface{}, capabilities []string
 		Capabilities:  capabilities,
 		SearchFields:  extractSearchFields(fields),
 		DisplayFields: extractDisplayFields(fields),
+		SoftDelete:    hasSoftDelete(modelType),
+		Versioned:     modelType.Implements(versionedType),
 	}
+	registerAdminActions(metadata, actions)
 
 	adminResources[name] = metadata
 	return metadata
 }
 
 func GetAdminResources() map[string]*ResourceMetadata {
+	linkOnce.Do(linkAdminResources)
 	return adminResources
 }
 
 func GetAdminResource(name string) *ResourceMetadata {
+	linkOnce.Do(linkAdminResources)
 	return adminResources[name]
 }
 
-func FetchAdminResourceData(resourceName string) any {
+// Can reports whether the resource declares a capability
+func (m *ResourceMetadata) Can(capability string) bool {
+	return contains(m.Capabilities, capability)
+}
+
+// RequireAdminCapability returns the resource named by the :resource
+// parameter, responding 404 for unknown resources and 403 when the resource
+// does not allow capability
+func RequireAdminCapability(c *gin.Context, capability string) *ResourceMetadata {
+	return RequireResourceCapability(c, c.Param("resource"), capability)
+}
+
+func RequireResourceCapability(c *gin.Context, name, capability string) *ResourceMetadata {
+	metadata := GetAdminResource(name)
+	if metadata == nil {
+		NotFoundResponse(c, "Unknown admin resource "+name)
+		Abort()
+	}
+	if !metadata.Can(capability) {
+		ForbiddenResponse(c, "Resource "+name+" does not allow "+capability)
+		Abort()
+	}
+	return metadata
+}
+
+// Columns maps the JSON name of every database backed field to its column
+func (m *ResourceMetadata) Columns() map[string]string {
+	columns := make(map[string]string)
+	for _, f := range m.Fields {
+		if f.Column != "" {
+			columns[f.Name] = f.Column
+		}
+	}
+	return columns
+}
+
+// SearchColumns returns the columns of the declared search fields
+func (m *ResourceMetadata) SearchColumns() []string {
+	columns := m.Columns()
+	var searchColumns []string
+	for _, name := range m.SearchFields {
+		if column, ok := columns[name]; ok {
+			searchColumns = append(searchColumns, column)
+		}
+	}
+	return searchColumns
+}
+
+// UniqueKeys returns the JSON names of the fields that identify a single
+// record: the primary key and columns with a single-column unique constraint
+func (m *ResourceMetadata) UniqueKeys() ([]string, error) {
+	stmt := &gorm.Statement{DB: db.DB}
+	if err := stmt.Parse(reflect.New(m.ModelType).Interface()); err != nil {
+		return nil, err
+	}
+
+	unique := make(map[string]bool)
+	for _, field := range stmt.Schema.Fields {
+		if field.PrimaryKey || field.Unique {
+			unique[field.DBName] = true
+		}
+	}
+	for _, index := range stmt.Schema.ParseIndexes() {
+		if index.Class == "UNIQUE" && len(index.Fields) == 1 {
+			unique[index.Fields[0].DBName] = true
+		}
+	}
+
+	var keys []string
+	for _, f := range m.Fields {
+		if f.Column != "" && unique[f.Column] {
+			keys = append(keys, f.Name)
+		}
+	}
+	return keys, nil
+}
+
+// EnsureAdminSearchIndexes creates the configured search index for the
+// search fields of every registered resource
+func EnsureAdminSearchIndexes() error {
+	kind := config.GetAdminSearchIndex()
+	if kind != "trigram" && kind != "tsvector" {
+		return nil
+	}
+
+	if kind == "trigram" {
+		if err := db.DB.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+			return err
+		}
+	}
+
+	for _, metadata := range adminResources {
+		columns := metadata.SearchColumns()
+		if len(columns) == 0 {
+			continue
+		}
+
+		stmt := &gorm.Statement{DB: db.DB}
+		if err := stmt.Parse(reflect.New(metadata.ModelType).Interface()); err != nil {
+			return err
+		}
+		table := stmt.Schema.Table
+
+		var statements []string
+		if kind == "trigram" {
+			for _, column := range columns {
+				statements = append(statements, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "idx_%s_%s_trgm" ON %q USING gin (%q gin_trgm_ops)`,
+					table, column, table, column))
+			}
+		} else {
+			statements = append(statements, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "idx_%s_search" ON %q USING gin ((%s))`,
+				table, table, searchVector(columns)))
+		}
+
+		for _, sql := range statements {
+			if err := db.DB.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("Admin %s search indexes are in place", kind)
+	return nil
+}
+
+// FetchAdminResourceData returns one page of a resource and the total number
+// of records matching the query filters
+func FetchAdminResourceData(resourceName string, query ListQuery) (any, int64) {
 	metadata := GetAdminResource(resourceName)
 	Check(metadata != nil)
-	
+
 	modelType := metadata.ModelType
 	sliceType := reflect.SliceOf(modelType)
 	slicePtr := reflect.New(sliceType)
-	
-	TryErr(db.DB.Find(slicePtr.Interface()).Error)
-	
-	return slicePtr.Elem().Interface()
+
+	filter := func(tx *gorm.DB) *gorm.DB {
+		return query.SearchIn(query.Filter(query.Trash(tx)), metadata.SearchColumns())
+	}
+
+	var total int64
+	TryErr(filter(db.DB.Model(reflect.New(modelType).Interface())).Count(&total).Error)
+
+	TryErr(query.Paginate(query.Order(filter(db.DB))).Find(slicePtr.Interface()).Error)
+
+	return slicePtr.Elem().Interface(), total
 }
 
 func CountAdminResource(resourceName string, where ...interface{}) int64 {
@@ -85,13 +271,18 @@ func CountAdminResource(resourceName string, where ...interface{}) int64 {
 	return count
 }
 
-func extractFields(t reflect.Type) []FieldMetadata {
+func extractFields(t reflect.Type, parent []int) []FieldMetadata {
 	var fields []FieldMetadata
 
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		
+		index := append(append([]int(nil), parent...), i)
+
+		// Embedded structs such as BaseModel contribute their own fields
 		if field.Anonymous {
+			if field.Type.Kind() == reflect.Struct {
+				fields = append(fields, extractFields(field.Type, index)...)
+			}
 			continue
 		}
 
@@ -105,12 +296,48 @@ func extractFields(t reflect.Type) []FieldMetadata {
 			fieldName = field.Name
 		}
 
+		column := columnName(field)
+		validation := field.Tag.Get("binding")
+		tag := adminTag(field)
+		_, readonly := tag["readonly"]
+		_, hidden := tag["hidden"]
+		_, list := tag["list"]
+		_, search := tag["search"]
+		order, _ := strconv.Atoi(tag["order"])
+
+		label := tag["label"]
+		if label == "" {
+			label = toLabel(field.Name)
+		}
+		options := oneOfOptions(validation)
+		if hasRule(validation, "plan") {
+			options = config.PlanKeys()
+		}
+		if enum := tag["enum"]; enum != "" {
+			options = strings.Split(enum, "|")
+		}
+
 		fieldMeta := FieldMetadata{
-			Name:     fieldName,
-			Type:     field.Type.String(),
-			Label:    toLabel(field.Name),
-			Required: !strings.Contains(field.Tag.Get("validate"), "omitempty"),
-			Editable: !isSystemField(field.Name),
+			Name:       fieldName,
+			Type:       field.Type.String(),
+			Label:      label,
+			Help:       tag["help"],
+			Required:   hasRule(validation, "required"),
+			Editable:   column != "" && !readonly,
+			Hidden:     hidden,
+			Order:      order,
+			Options:    options,
+			Ref:        tag["ref"],
+			List:       list && !hidden,
+			Search:     search && !hidden,
+			Private:    field.Tag.Get("public") == "false",
+			Column:     column,
+			Index:      index,
+			Validation: validation,
+		}
+		fieldMeta.Widget = tag["widget"]
+		if fieldMeta.Widget == "" {
+			fieldMeta.Widget = fieldWidget(field.Type, fieldMeta)
 		}
 
 		fields = append(fields, fieldMeta)
@@ -119,56 +346,158 @@ func extractFields(t reflect.Type) []FieldMetadata {
 	return fields
 }
 
+// adminTag parses an admin:"key=value,flag" struct tag. Flags map to "".
+func adminTag(field reflect.StructField) map[string]string {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(field.Tag.Get("admin"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if key != "" {
+			settings[key] = value
+		}
+	}
+	return settings
+}
+
+// hasRule reports whether a binding tag contains rule
+func hasRule(validation, rule string) bool {
+	for _, r := range strings.Split(validation, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldWidget is the input widget of a field without a widget setting
+func fieldWidget(t reflect.Type, f FieldMetadata) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case f.Ref != "":
+		return "reference"
+	case len(f.Options) > 0:
+		return "select"
+	case t == timeType:
+		return "datetime"
+	case t == uuidType:
+		return "text"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "checkbox"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		return "json"
+	}
+	return "text"
+}
+
+// oneOfOptions returns the allowed values of a oneof binding rule
+func oneOfOptions(validation string) []string {
+	for _, rule := range strings.Split(validation, ",") {
+		if strings.HasPrefix(rule, "oneof=") {
+			return strings.Fields(strings.TrimPrefix(rule, "oneof="))
+		}
+	}
+	return nil
+}
+
+// Field returns the metadata of the field with the given JSON name
+func (m *ResourceMetadata) Field(name string) (FieldMetadata, bool) {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FieldMetadata{}, false
+}
+
+// columnName returns the database column of a field, or "" for associations
+func columnName(field reflect.StructField) string {
+	settings := schema.ParseTagSetting(field.Tag.Get("gorm"), ";")
+	if _, ok := settings["-"]; ok {
+		return ""
+	}
+	if column, ok := settings["COLUMN"]; ok {
+		return column
+	}
+
+	_, serialized := settings["SERIALIZER"]
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if !serialized && t != reflect.TypeOf(time.Time{}) {
+		if t.Kind() == reflect.Struct || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct) {
+			return ""
+		}
+	}
+
+	return schema.NamingStrategy{}.ColumnName("", field.Name)
+}
+
+// extractSearchFields returns the fields tagged search, or every visible
+// string column when none is
 func extractSearchFields(fields []FieldMetadata) []string {
 	var searchFields []string
 	for _, f := range fields {
-		if f.Type == "string" && !isSystemField(f.Name) {
+		if f.Search && f.Column != "" {
+			searchFields = append(searchFields, f.Name)
+		}
+	}
+	if len(searchFields) > 0 {
+		return searchFields
+	}
+
+	for _, f := range fields {
+		if f.Type == "string" && f.Column != "" && !f.Hidden {
 			searchFields = append(searchFields, f.Name)
 		}
 	}
 	return searchFields
 }
 
+// extractDisplayFields returns the fields tagged list, or the first five
+// visible editable fields when none is
 func extractDisplayFields(fields []FieldMetadata) []string {
 	var displayFields []string
-	priority := []string{"name", "title", "email", "slug", "status"}
-	
-	for _, p := range priority {
-		for _, f := range fields {
-			if strings.ToLower(f.Name) == p {
-				displayFields = append(displayFields, f.Name)
-				break
-			}
+	for _, f := range fields {
+		if f.List {
+			displayFields = append(displayFields, f.Name)
 		}
 	}
-	
+	if len(displayFields) > 0 {
+		return displayFields
+	}
+
 	for _, f := range fields {
 		if len(displayFields) >= 5 {
 			break
 		}
-		if !contains(displayFields, f.Name) && !isSystemField(f.Name) {
+		if f.Editable && !f.Hidden {
 			displayFields = append(displayFields, f.Name)
 		}
 	}
-	
 	return displayFields
 }
 
-func isSystemField(name string) bool {
-	systemFields := []string{"ID", "CreatedAt", "UpdatedAt", "DeletedAt", "PasswordHash"}
-	for _, sf := range systemFields {
-		if name == sf {
-			return true
-		}
-	}
-	return false
-}
-
+// toLabel splits a Go field name into words, keeping acronyms such as ID
+// together
 func toLabel(name string) string {
+	runes := []rune(name)
 	result := ""
-	for i, c := range name {
-		if i > 0 && c >= 'A' && c <= 'Z' {
-			result += " "
+	for i, c := range runes {
+		upper := c >= 'A' && c <= 'Z'
+		if i > 0 && upper {
+			prevLower := runes[i-1] >= 'a' && runes[i-1] <= 'z'
+			nextLower := i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z'
+			if prevLower || nextLower {
+				result += " "
+			}
 		}
 		result += string(c)
 	}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AdminActionHandler runs an action on record, a pointer to the resource's
+// model, inside tx. input points to a filled in copy of the action's Input,
+// or is nil for actions without input. The result is returned to the admin
+// and recorded in the audit log. Refusals are returned as an HTTPError, such
+// as a 409 for voiding a paid invoice.
+type AdminActionHandler func(c *gin.Context, tx *gorm.DB, record any, input any) (any, error)
+
+// AdminAction is an operation beyond CRUD that an admin runs on one record,
+// such as resetting a password. Input is a struct whose fields describe the
+// form shown before the action runs, using the same tags as models.
+// Capability, the action's name by default, must be one of the capabilities
+// the resource is registered with for the action to run.
+type AdminAction struct {
+	Name        string
+	Label       string
+	Confirm     string
+	Capability  string
+	InputFields []FieldMetadata
+	Input       any                `json:"-"`
+	Handler     AdminActionHandler `json:"-"`
+	input       *ResourceMetadata
+}
+
+// registerAdminActions fills in the defaults of actions. An action runs only
+// when the resource was registered with its capability.
+func registerAdminActions(metadata *ResourceMetadata, actions []AdminAction) {
+	for _, action := range actions {
+		if action.Handler == nil {
+			panic(fmt.Sprintf("admin action %s.%s has no handler", metadata.Name, action.Name))
+		}
+		if action.Label == "" {
+			action.Label = toLabel(capitalize(action.Name))
+		}
+		if action.Capability == "" {
+			action.Capability = action.Name
+		}
+
+		if action.Input != nil {
+			inputType := reflect.TypeOf(action.Input)
+			if inputType.Kind() == reflect.Ptr {
+				inputType = inputType.Elem()
+			}
+			action.InputFields = extractFields(inputType, nil)
+			action.input = &ResourceMetadata{
+				Name:      action.Name,
+				ModelType: inputType,
+				Fields:    action.InputFields,
+			}
+		}
+
+		metadata.Actions = append(metadata.Actions, action)
+	}
+}
+
+// Action returns the action with the given name, or nil
+func (m *ResourceMetadata) Action(name string) *AdminAction {
+	for i := range m.Actions {
+		if m.Actions[i].Name == name {
+			return &m.Actions[i]
+		}
+	}
+	return nil
+}
+
+// ParseInput converts the JSON input of an action to a pointer to its Input
+// type, checking every field against its binding rules. Actions without
+// input accept no values.
+func (a *AdminAction) ParseInput(data map[string]interface{}) (any, FieldErrors) {
+	if a.input == nil {
+		errs := FieldErrors{}
+		for key := range data {
+			errs[key] = "is not an input of " + a.Name
+		}
+		return nil, errs
+	}
+
+	inputPtr := reflect.New(a.input.ModelType)
+	errs := ApplyAdminValues(a.input, inputPtr.Elem(), data)
+	for field, problem := range ValidateAdminRecord(a.input, inputPtr.Elem()) {
+		if _, ok := errs[field]; !ok {
+			errs[field] = problem
+		}
+	}
+	return inputPtr.Interface(), errs
+}
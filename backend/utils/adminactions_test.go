@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type actionTestRecord struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestAdminActionNeedsCapability(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	noop := func(*gin.Context, *gorm.DB, any, any) (any, error) { return nil, nil }
+
+	metadata := RegisterAdminResource("actionTest", actionTestRecord{}, []string{"list", "view", "archive"},
+		AdminAction{Name: "archive", Handler: noop},
+		AdminAction{Name: "wipe", Handler: noop},
+		AdminAction{Name: "reindex", Capability: "maintain", Handler: noop},
+	)
+	defer delete(adminResources, "actionTest")
+
+	tests := []struct {
+		action string
+		status int
+	}{
+		{"archive", http.StatusOK},
+		{"wipe", http.StatusForbidden},
+		{"reindex", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		action := metadata.Action(tt.action)
+		if action == nil {
+			t.Fatalf("action %s is not registered", tt.action)
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		H(c, func() {
+			RequireResourceCapability(c, metadata.Name, action.Capability)
+			c.Status(http.StatusOK)
+		})
+		if w.Code != tt.status {
+			t.Errorf("%s answered %d, want %d", tt.action, w.Code, tt.status)
+		}
+	}
+	if metadata.Can("wipe") || metadata.Can("maintain") {
+		t.Errorf("actions added their capabilities: %v", metadata.Capabilities)
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxBulkRecords caps the records a single bulk action may touch
+	MaxBulkRecords = 10000
+	// BulkProgressInterval is how many records pass between progress reports
+	BulkProgressInterval = 100
+)
+
+// Bulk actions and the capability each one requires
+var BulkActions = map[string]string{
+	"update": "edit",
+	"delete": "delete",
+}
+
+// BulkResult counts the outcome of a bulk action. Failures lists only the
+// records that could not be changed.
+type BulkResult struct {
+	Action    string        `json:"action"`
+	Total     int           `json:"total"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Failures  []BulkFailure `json:"failures"`
+}
+
+type BulkFailure struct {
+	ID     uuid.UUID   `json:"id"`
+	Error  string      `json:"error,omitempty"`
+	Fields FieldErrors `json:"fields,omitempty"`
+}
+
+// BulkAdminIDs returns the IDs of the records matching the query filters and
+// search, refusing selections larger than MaxBulkRecords
+func BulkAdminIDs(tx *gorm.DB, metadata *ResourceMetadata, query ListQuery) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	model := reflect.New(metadata.ModelType).Interface()
+	err := query.SearchIn(query.Filter(tx.Model(model)), metadata.SearchColumns()).
+		Limit(MaxBulkRecords+1).Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > MaxBulkRecords {
+		return nil, fmt.Errorf("the selection matches more than %d records", MaxBulkRecords)
+	}
+	return ids, nil
+}
+
+// BulkAdminAction applies action to every record in ids and audits each
+// change. Each record is changed under its own savepoint so that one failure
+// does not undo the rest; progress is called every BulkProgressInterval
+// records.
+func BulkAdminAction(tx *gorm.DB, actor AuditActor, metadata *ResourceMetadata, ids []uuid.UUID, action string, values map[string]interface{}, progress func(done, total int)) (BulkResult, error) {
+	result := BulkResult{Action: action, Total: len(ids), Failures: []BulkFailure{}}
+	if _, ok := BulkActions[action]; !ok {
+		return result, fmt.Errorf("unknown bulk action %q", action)
+	}
+
+	for i, id := range ids {
+		failure := bulkAdminRecord(tx, actor, metadata, id, action, values)
+		if failure != nil {
+			result.Failed++
+			result.Failures = append(result.Failures, *failure)
+		} else {
+			result.Succeeded++
+		}
+
+		if progress != nil && (i+1)%BulkProgressInterval == 0 {
+			progress(i+1, len(ids))
+		}
+	}
+	return result, nil
+}
+
+func bulkAdminRecord(tx *gorm.DB, actor AuditActor, metadata *ResourceMetadata, id uuid.UUID, action string, values map[string]interface{}) *BulkFailure {
+	recordPtr := reflect.New(metadata.ModelType)
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(recordPtr.Interface(), "id = ?", id).Error
+	if err != nil {
+		return &BulkFailure{ID: id, Error: "record not found"}
+	}
+
+	before := SnapshotRecord(recordPtr.Interface())
+	if action == "update" {
+		if errs := ApplyAdminValues(metadata, recordPtr.Elem(), values); len(errs) > 0 {
+			return &BulkFailure{ID: id, Fields: errs}
+		}
+	}
+
+	if err := tx.SavePoint("bulk_record").Error; err != nil {
+		return &BulkFailure{ID: id, Error: err.Error()}
+	}
+	if action == "delete" {
+		err = tx.Delete(recordPtr.Interface()).Error
+		if err == nil {
+			err = Audit(tx, actor, action, metadata.Name, id.String(), before, nil)
+		}
+	} else {
+		err = tx.Save(recordPtr.Interface()).Error
+		if err == nil {
+			err = Audit(tx, actor, action, metadata.Name, id.String(), before, SnapshotRecord(recordPtr.Interface()))
+		}
+	}
+	if err != nil {
+		tx.RollbackTo("bulk_record")
+		return &BulkFailure{ID: id, Error: err.Error()}
+	}
+	return nil
+}
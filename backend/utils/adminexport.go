@@ -0,0 +1,389 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"platform/backend/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Admin export and import formats
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+var exportContentTypes = map[string]string{
+	FormatCSV:    "text/csv; charset=utf-8",
+	FormatJSON:   "application/json; charset=utf-8",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// ExportContentType returns the content type of an export format, or "" for
+// unknown formats
+func ExportContentType(format string) string {
+	return exportContentTypes[format]
+}
+
+// ImportReport summarises an import. Rows lists only the rows that failed.
+type ImportReport struct {
+	DryRun  bool              `json:"dryRun"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ImportRowResult reports why a row was rejected. Row counts data rows from 1.
+type ImportRowResult struct {
+	Row    int         `json:"row"`
+	Error  string      `json:"error,omitempty"`
+	Fields FieldErrors `json:"fields,omitempty"`
+}
+
+// exportFields returns the database backed fields that may leave the server
+func exportFields(metadata *ResourceMetadata) []FieldMetadata {
+	var fields []FieldMetadata
+	for _, f := range metadata.Fields {
+		if f.Column != "" && !f.Private {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// ExportAdminResource streams every record matching the query filters and
+// search to w in the query order
+func ExportAdminResource(w io.Writer, metadata *ResourceMetadata, query ListQuery, format string) error {
+	fields := exportFields(metadata)
+	model := reflect.New(metadata.ModelType).Interface()
+
+	tx := query.Order(query.SearchIn(query.Filter(query.Trash(db.DB.Model(model))), metadata.SearchColumns()))
+	rows, err := tx.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	csvWriter := csv.NewWriter(w)
+	switch format {
+	case FormatCSV:
+		header := make([]string, len(fields))
+		for i, f := range fields {
+			header[i] = f.Name
+		}
+		if err := csvWriter.Write(header); err != nil {
+			return err
+		}
+	case FormatJSON:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return err
+		}
+	}
+
+	count := 0
+	for rows.Next() {
+		record := reflect.New(metadata.ModelType).Interface()
+		if err := db.DB.ScanRows(rows, record); err != nil {
+			return err
+		}
+		values, err := exportValues(record, fields)
+		if err != nil {
+			return err
+		}
+
+		switch format {
+		case FormatCSV:
+			err = csvWriter.Write(csvCells(values))
+		case FormatJSON:
+			if count > 0 {
+				_, err = io.WriteString(w, ",")
+			}
+			if err == nil {
+				_, err = w.Write(jsonObject(fields, values))
+			}
+		case FormatNDJSON:
+			_, err = w.Write(append(jsonObject(fields, values), '\n'))
+		}
+		if err != nil {
+			return err
+		}
+
+		count++
+		if count%500 == 0 {
+			csvWriter.Flush()
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		if _, err := io.WriteString(w, "]"); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// exportValues returns the JSON encoding of each field of record
+func exportValues(record interface{}, fields []FieldMetadata) ([]json.RawMessage, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var encoded map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &encoded); err != nil {
+		return nil, err
+	}
+
+	values := make([]json.RawMessage, len(fields))
+	for i, f := range fields {
+		values[i] = encoded[f.Name]
+		if values[i] == nil {
+			values[i] = json.RawMessage("null")
+		}
+	}
+	return values, nil
+}
+
+func jsonObject(fields []FieldMetadata, values []json.RawMessage) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.Name)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(values[i])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// csvCells writes strings unquoted, null as an empty cell and everything else
+// as its JSON encoding
+func csvCells(values []json.RawMessage) []string {
+	cells := make([]string, len(values))
+	for i, value := range values {
+		switch {
+		case string(value) == "null":
+		case len(value) > 0 && value[0] == '"':
+			json.Unmarshal(value, &cells[i])
+		default:
+			cells[i] = string(value)
+		}
+	}
+	return cells
+}
+
+// ReadAdminImport decodes the rows of a CSV, JSON array or NDJSON import.
+// Empty CSV cells are left out so that defaults apply, and cells of
+// structured fields hold JSON.
+func ReadAdminImport(r io.Reader, metadata *ResourceMetadata, format string) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV header: %w", err)
+		}
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			row := make(map[string]interface{})
+			for i, name := range header {
+				if i >= len(record) || record[i] == "" {
+					continue
+				}
+				row[name] = record[i]
+				if f, ok := metadata.Field(name); ok && isStructuredField(metadata, f) {
+					var value interface{}
+					if err := json.Unmarshal([]byte(record[i]), &value); err == nil {
+						row[name] = value
+					}
+				}
+			}
+			rows = append(rows, row)
+		}
+
+	case FormatJSON:
+		if err := json.NewDecoder(r).Decode(&rows); err != nil {
+			return nil, fmt.Errorf("reading JSON rows: %w", err)
+		}
+
+	case FormatNDJSON:
+		decoder := json.NewDecoder(r)
+		for {
+			var row map[string]interface{}
+			err := decoder.Decode(&row)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("reading NDJSON row %d: %w", len(rows)+1, err)
+			}
+			rows = append(rows, row)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+
+	return rows, nil
+}
+
+func isStructuredField(metadata *ResourceMetadata, f FieldMetadata) bool {
+	t := metadata.ModelType.FieldByIndex(f.Index).Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == uuidType || t == timeType {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		return true
+	}
+	return false
+}
+
+// ImportAdminRecords creates or updates a record for every row, matching
+// existing records by the key field. Rows that fail are rolled back on their
+// own and reported; a dry run rolls back every row.
+func ImportAdminRecords(tx *gorm.DB, actor AuditActor, metadata *ResourceMetadata, rows []map[string]interface{}, key string, dryRun bool) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun, Rows: []ImportRowResult{}}
+
+	keyField, ok := metadata.Field(key)
+	if !ok {
+		return report, fmt.Errorf("unknown key field %q", key)
+	}
+
+	if dryRun {
+		if err := tx.SavePoint("import").Error; err != nil {
+			return report, err
+		}
+	}
+
+	for i, row := range rows {
+		created, result := importAdminRow(tx, actor, metadata, keyField, row)
+		result.Row = i + 1
+
+		switch {
+		case result.Error != "" || len(result.Fields) > 0:
+			report.Failed++
+			report.Rows = append(report.Rows, result)
+		case created:
+			report.Created++
+		default:
+			report.Updated++
+		}
+	}
+
+	if dryRun {
+		return report, tx.RollbackTo("import").Error
+	}
+	return report, nil
+}
+
+func importAdminRow(tx *gorm.DB, actor AuditActor, metadata *ResourceMetadata, keyField FieldMetadata, row map[string]interface{}) (bool, ImportRowResult) {
+	var result ImportRowResult
+
+	// System fields such as timestamps are exported but never imported
+	values := make(map[string]interface{})
+	for name, value := range row {
+		if f, ok := metadata.Field(name); !ok || f.Editable {
+			values[name] = value
+		}
+	}
+
+	recordPtr := reflect.New(metadata.ModelType)
+	record := recordPtr.Elem()
+
+	var keyValue reflect.Value
+	found := false
+	if raw, ok := row[keyField.Name]; ok && raw != nil && raw != "" {
+		var err error
+		keyValue, err = coerceAdminValue(raw, record.FieldByIndex(keyField.Index).Type())
+		if err != nil {
+			result.Fields = FieldErrors{keyField.Name: err.Error()}
+			return false, result
+		}
+
+		err = tx.Where(clause.Eq{Column: clause.Column{Name: keyField.Column}, Value: keyValue.Interface()}).
+			First(recordPtr.Interface()).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			result.Error = err.Error()
+			return false, result
+		}
+		found = err == nil
+	}
+
+	var before AuditSnapshot
+	if found {
+		before = SnapshotRecord(recordPtr.Interface())
+	}
+
+	errs := ApplyAdminValues(metadata, record, values)
+	if !found {
+		if keyValue.IsValid() {
+			record.FieldByIndex(keyField.Index).Set(keyValue)
+		}
+		for name, problem := range ValidateAdminRecord(metadata, record) {
+			if _, ok := errs[name]; !ok {
+				errs[name] = problem
+			}
+		}
+	}
+	if len(errs) > 0 {
+		result.Fields = errs
+		return !found, result
+	}
+
+	// A savepoint keeps a failed row from aborting the whole transaction
+	if err := tx.SavePoint("import_row").Error; err != nil {
+		result.Error = err.Error()
+		return !found, result
+	}
+	var err error
+	action := "create"
+	if found {
+		action = "update"
+		err = tx.Save(recordPtr.Interface()).Error
+	} else {
+		err = tx.Create(recordPtr.Interface()).Error
+	}
+	if err == nil {
+		id := fmt.Sprint(record.FieldByName("ID").Interface())
+		err = Audit(tx, actor, action, metadata.Name, id, before, SnapshotRecord(recordPtr.Interface()))
+	}
+	if err != nil {
+		tx.RollbackTo("import_row")
+		result.Error = err.Error()
+	}
+	return !found, result
+}
@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"platform/backend/db"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	RelationBelongsTo = "belongsTo"
+	RelationHasMany   = "hasMany"
+
+	// MaxLookupOptions caps the options returned for a select box
+	MaxLookupOptions = 20
+)
+
+// RelationMetadata links a resource to another through ForeignKey, the JSON
+// name of the foreign key field on the belongs-to side
+type RelationMetadata struct {
+	Name       string
+	Kind       string
+	Resource   string
+	ForeignKey string
+}
+
+// LookupOption is a record as shown in a select box
+type LookupOption struct {
+	ID    uuid.UUID `json:"id"`
+	Label string    `json:"label"`
+}
+
+var linkOnce sync.Once
+
+// linkAdminResources fills in the relations of every registered resource from
+// admin:"ref=..." tags and gorm associations between registered models. It
+// runs once, after all resources have registered.
+func linkAdminResources() {
+	byType := make(map[reflect.Type]*ResourceMetadata)
+	for _, m := range adminResources {
+		byType[m.ModelType] = m
+	}
+
+	for _, m := range adminResources {
+		s, err := schema.Parse(reflect.New(m.ModelType).Interface(), &sync.Map{}, schema.NamingStrategy{})
+		if err != nil {
+			continue
+		}
+		for _, rel := range s.Relationships.BelongsTo {
+			if target := byType[rel.FieldSchema.ModelType]; target != nil {
+				for _, ref := range rel.References {
+					setFieldRef(m, ref.ForeignKey.DBName, target.Name)
+				}
+			}
+		}
+		for _, rel := range s.Relationships.HasMany {
+			if target := byType[rel.FieldSchema.ModelType]; target != nil {
+				for _, ref := range rel.References {
+					setFieldRef(target, ref.ForeignKey.DBName, m.Name)
+				}
+			}
+		}
+	}
+
+	for _, m := range adminResources {
+		for _, f := range m.Fields {
+			target := adminResources[f.Ref]
+			if target == nil {
+				continue
+			}
+
+			m.Relations = append(m.Relations, RelationMetadata{
+				Name:       strings.TrimSuffix(f.Name, "Id"),
+				Kind:       RelationBelongsTo,
+				Resource:   target.Name,
+				ForeignKey: f.Name,
+			})
+
+			name := m.PluralName
+			if target.Relation(name) != nil {
+				name += "By" + capitalize(strings.TrimSuffix(f.Name, "Id"))
+			}
+			target.Relations = append(target.Relations, RelationMetadata{
+				Name:       name,
+				Kind:       RelationHasMany,
+				Resource:   m.Name,
+				ForeignKey: f.Name,
+			})
+		}
+	}
+
+	for _, m := range adminResources {
+		sort.SliceStable(m.Relations, func(i, j int) bool {
+			return m.Relations[i].Name < m.Relations[j].Name
+		})
+	}
+}
+
+func setFieldRef(m *ResourceMetadata, column, ref string) {
+	for i := range m.Fields {
+		if m.Fields[i].Column == column && m.Fields[i].Ref == "" {
+			m.Fields[i].Ref = ref
+		}
+	}
+}
+
+// Relation returns the relation with the given name, or nil
+func (m *ResourceMetadata) Relation(name string) *RelationMetadata {
+	for i := range m.Relations {
+		if m.Relations[i].Name == name {
+			return &m.Relations[i]
+		}
+	}
+	return nil
+}
+
+// labelColumn is the column shown for a record of the resource in select
+// boxes, the first of its display fields
+func (m *ResourceMetadata) labelColumn() string {
+	columns := m.Columns()
+	for _, name := range m.DisplayFields {
+		if column, ok := columns[name]; ok {
+			return column
+		}
+	}
+	return "id"
+}
+
+// AdminLookup returns select box options of a resource, either the records
+// with the given IDs or those matching search
+func AdminLookup(metadata *ResourceMetadata, search string, ids []uuid.UUID) ([]LookupOption, error) {
+	options := []LookupOption{}
+	label := metadata.labelColumn()
+
+	tx := db.DB.Model(reflect.New(metadata.ModelType).Interface()).
+		Select("id, CAST(? AS text) AS label", clause.Column{Name: label})
+	if len(ids) > 0 {
+		tx = tx.Where("id IN ?", ids)
+	} else {
+		tx = ListQuery{Search: search}.SearchIn(tx, metadata.SearchColumns()).
+			Order(clause.OrderByColumn{Column: clause.Column{Name: label}}).
+			Limit(MaxLookupOptions)
+	}
+
+	return options, tx.Scan(&options).Error
+}
+
+// AdminRelatedLabels looks up the records that items, a slice of the
+// resource's model, belong to through the named relations. The result maps
+// relation name and record ID to the related record's option.
+func AdminRelatedLabels(metadata *ResourceMetadata, items any, relations []string) (map[string]map[uuid.UUID]LookupOption, error) {
+	related := make(map[string]map[uuid.UUID]LookupOption)
+	slice := reflect.ValueOf(items)
+
+	for _, name := range relations {
+		relation := metadata.Relation(name)
+		if relation == nil || relation.Kind != RelationBelongsTo {
+			continue
+		}
+		field, _ := metadata.Field(relation.ForeignKey)
+
+		var ids []uuid.UUID
+		for i := 0; i < slice.Len(); i++ {
+			value := slice.Index(i).FieldByIndex(field.Index)
+			if value.Kind() == reflect.Ptr {
+				if value.IsNil() {
+					continue
+				}
+				value = value.Elem()
+			}
+			if id, ok := value.Interface().(uuid.UUID); ok && id != uuid.Nil {
+				ids = append(ids, id)
+			}
+		}
+
+		related[name] = make(map[uuid.UUID]LookupOption)
+		if len(ids) == 0 {
+			continue
+		}
+
+		options, err := AdminLookup(GetAdminResource(relation.Resource), "", ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, option := range options {
+			related[name][option.ID] = option
+		}
+	}
+
+	return related, nil
+}
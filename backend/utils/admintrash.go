@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/db"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// hasSoftDelete reports whether a model, or a struct it embeds, has a
+// gorm.DeletedAt field
+func hasSoftDelete(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type == deletedAtType {
+			return true
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && hasSoftDelete(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindAdminRecord loads a record by ID including soft-deleted ones, and
+// reports whether it is in the trash
+func FindAdminRecord(metadata *ResourceMetadata, id uuid.UUID) (reflect.Value, bool, error) {
+	recordPtr := reflect.New(metadata.ModelType)
+	if err := db.DB.Unscoped().First(recordPtr.Interface(), "id = ?", id).Error; err != nil {
+		return recordPtr, false, err
+	}
+
+	trashed := false
+	if metadata.SoftDelete {
+		deletedAt, _ := recordPtr.Elem().FieldByName("DeletedAt").Interface().(gorm.DeletedAt)
+		trashed = deletedAt.Valid
+	}
+	return recordPtr, trashed, nil
+}
+
+// Purge actions say what purging a record does to the rows of another
+// table that reference it
+const (
+	// PurgeRestrict refuses the purge while rows reference the record
+	PurgeRestrict = "restrict"
+	// PurgeCascade purges the rows too, applying the references to them
+	PurgeCascade = "cascade"
+	// PurgeNullify clears the reference
+	PurgeNullify = "nullify"
+	// PurgeKeep leaves the reference, as history that outlives the record
+	PurgeKeep = "keep"
+)
+
+// PurgeReference is a column of the table of Model that references records
+// of another table, and what purging one of them does to its rows
+type PurgeReference struct {
+	Model  any
+	Column string
+	Action string
+}
+
+// purgeReferences holds the references to the records of each model
+var purgeReferences = make(map[reflect.Type][]PurgeReference)
+
+// RegisterPurgeReferences declares every column that references records of
+// model, in admin resources or any other table. Records of models without
+// a declaration, or rows a purge would cascade to, are never purged.
+func RegisterPurgeReferences(model any, references ...PurgeReference) {
+	purgeReferences[indirectType(reflect.TypeOf(model))] = references
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// PurgeTrash permanently deletes records of every purgeable admin resource
+// that have been in the trash longer than config.GetTrashRetentionDays.
+// Records with PurgeBlockers are kept.
+func PurgeTrash(now time.Time) error {
+	days := config.GetTrashRetentionDays()
+	if days == 0 {
+		return nil
+	}
+	cutoff := now.AddDate(0, 0, -days)
+
+	for _, metadata := range GetAdminResources() {
+		if !metadata.SoftDelete || !metadata.Can("purge") {
+			continue
+		}
+
+		var ids []uuid.UUID
+		err := db.DB.Unscoped().Model(reflect.New(metadata.ModelType).Interface()).
+			Where("deleted_at < ?", cutoff).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+
+		purged := 0
+		for _, id := range ids {
+			err := db.DB.Transaction(func(tx *gorm.DB) error {
+				blockers, err := PurgeBlockers(tx, metadata.ModelType, id)
+				if err != nil || len(blockers) > 0 {
+					if len(blockers) > 0 {
+						log.Printf("Kept %s %s in the trash, still referenced by %s", metadata.Name, id, strings.Join(blockers, ", "))
+					}
+					return err
+				}
+				purged++
+				return PurgeRecords(tx, metadata.ModelType, id)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if purged > 0 {
+			log.Printf("Purged %d %s from the trash", purged, metadata.PluralName)
+		}
+	}
+	return nil
+}
+
+// PurgeBlockers returns the references, as table.column, that keep records
+// of modelType from being purged: restricted references to them or to the
+// rows the purge would cascade to. Nothing in the database keeps references
+// valid, so records with blockers must not be purged.
+func PurgeBlockers(tx *gorm.DB, modelType reflect.Type, ids ...uuid.UUID) ([]string, error) {
+	references, ok := purgeReferences[modelType]
+	if !ok {
+		return nil, fmt.Errorf("%s declares no purge references", modelType.Name())
+	}
+
+	var blockers []string
+	for _, ref := range references {
+		switch ref.Action {
+		case PurgeRestrict:
+			var count int64
+			if err := ref.rows(tx, ids).Limit(1).Count(&count).Error; err != nil {
+				return nil, err
+			}
+			if count > 0 {
+				blockers = append(blockers, ref.name(tx))
+			}
+		case PurgeCascade:
+			var rows []uuid.UUID
+			if err := ref.rows(tx, ids).Pluck("id", &rows).Error; err != nil {
+				return nil, err
+			}
+			if len(rows) == 0 {
+				continue
+			}
+			nested, err := PurgeBlockers(tx, ref.modelType(), rows...)
+			if err != nil {
+				return nil, err
+			}
+			blockers = append(blockers, nested...)
+		case PurgeNullify, PurgeKeep:
+		default:
+			return nil, fmt.Errorf("unknown purge action %q of %s", ref.Action, ref.name(tx))
+		}
+	}
+	return blockers, nil
+}
+
+// PurgeRecords permanently deletes records of modelType through tx and
+// applies the references to them. Check PurgeBlockers first.
+func PurgeRecords(tx *gorm.DB, modelType reflect.Type, ids ...uuid.UUID) error {
+	for _, ref := range purgeReferences[modelType] {
+		switch ref.Action {
+		case PurgeCascade:
+			var rows []uuid.UUID
+			if err := ref.rows(tx, ids).Pluck("id", &rows).Error; err != nil {
+				return err
+			}
+			if len(rows) > 0 {
+				if err := PurgeRecords(tx, ref.modelType(), rows...); err != nil {
+					return err
+				}
+			}
+		case PurgeNullify:
+			if err := ref.rows(tx, ids).Update(ref.Column, nil).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(reflect.New(modelType).Interface()).Error
+}
+
+func (r PurgeReference) modelType() reflect.Type {
+	return indirectType(reflect.TypeOf(r.Model))
+}
+
+// rows selects the rows, live or in the trash, that reference ids
+func (r PurgeReference) rows(tx *gorm.DB, ids []uuid.UUID) *gorm.DB {
+	return tx.Unscoped().Model(reflect.New(r.modelType()).Interface()).
+		Where(clause.IN{Column: clause.Column{Name: r.Column}, Values: uuidValues(ids)})
+}
+
+func (r PurgeReference) name(tx *gorm.DB) string {
+	return tx.NamingStrategy.TableName(r.modelType().Name()) + "." + r.Column
+}
+
+func uuidValues(ids []uuid.UUID) []any {
+	values := make([]any, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	return values
+}
+
+// RestoreConflicts returns the JSON names of the fields of record, a trashed
+// record of the resource, that a live record now holds under a unique index,
+// which restoring it would violate
+func RestoreConflicts(tx *gorm.DB, metadata *ResourceMetadata, record any) ([]string, error) {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(record); err != nil {
+		return nil, err
+	}
+
+	var keys [][]*schema.Field
+	for _, field := range stmt.Schema.Fields {
+		if field.Unique && !field.PrimaryKey {
+			keys = append(keys, []*schema.Field{field})
+		}
+	}
+	for _, index := range stmt.Schema.ParseIndexes() {
+		if index.Class == "UNIQUE" {
+			var fields []*schema.Field
+			for _, option := range index.Fields {
+				fields = append(fields, option.Field)
+			}
+			keys = append(keys, fields)
+		}
+	}
+
+	value := reflect.ValueOf(record)
+	id, _ := value.Elem().FieldByName("ID").Interface().(uuid.UUID)
+	var conflicts []string
+	for _, fields := range keys {
+		query := tx.Model(reflect.New(metadata.ModelType).Interface()).Where("id <> ?", id)
+		for _, field := range fields {
+			fieldValue, _ := field.ValueOf(tx.Statement.Context, value)
+			query = query.Where(clause.Eq{Column: clause.Column{Name: field.DBName}, Value: fieldValue})
+		}
+
+		var count int64
+		if err := query.Limit(1).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			for _, field := range fields {
+				conflicts = append(conflicts, metadata.fieldName(field.DBName))
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// fieldName returns the JSON name of the field stored in column
+func (m *ResourceMetadata) fieldName(column string) string {
+	for _, f := range m.Fields {
+		if f.Column == column {
+			return f.Name
+		}
+	}
+	return column
+}
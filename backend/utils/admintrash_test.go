@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	"platform/backend/db"
+	"platform/backend/models"
+
+	"github.com/google/uuid"
+)
+
+func TestPurgeReferences(t *testing.T) {
+	previous := purgeReferences
+	purgeReferences = make(map[reflect.Type][]PurgeReference)
+	t.Cleanup(func() { purgeReferences = previous })
+
+	RegisterPurgeReferences(models.User{},
+		PurgeReference{Model: models.Subscription{}, Column: "user_id", Action: PurgeCascade},
+		PurgeReference{Model: models.UsageEvent{}, Column: "user_id", Action: PurgeCascade},
+		PurgeReference{Model: models.AuditLog{}, Column: "actor_id", Action: PurgeKeep},
+	)
+	RegisterPurgeReferences(models.Subscription{},
+		PurgeReference{Model: models.CouponRedemption{}, Column: "subscription_id", Action: PurgeNullify},
+		PurgeReference{Model: models.Invoice{}, Column: "subscription_id", Action: PurgeRestrict},
+	)
+	RegisterPurgeReferences(models.UsageEvent{})
+
+	userID, subscriptionID := uuid.New(), uuid.New()
+	invoices := int64(0)
+	f := fakeDB(t, func(query string, args []driver.Value) []map[string]driver.Value {
+		switch {
+		case strings.HasPrefix(query, `SELECT "id" FROM "subscriptions"`):
+			return []map[string]driver.Value{{"id": subscriptionID.String()}}
+		case strings.HasPrefix(query, `SELECT "id" FROM "usage_events"`):
+			return []map[string]driver.Value{{"id": uuid.NewString()}}
+		case strings.HasPrefix(query, `SELECT count(*) FROM "invoices"`):
+			return []map[string]driver.Value{{"count": invoices}}
+		}
+		return nil
+	})
+	userType := reflect.TypeOf(models.User{})
+
+	invoices = 1
+	blockers, err := PurgeBlockers(db.DB, userType, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(blockers, []string{"invoices.subscription_id"}) {
+		t.Fatalf("blockers = %v, want the invoices of the cascaded subscription", blockers)
+	}
+
+	invoices = 0
+	if blockers, err := PurgeBlockers(db.DB, userType, userID); err != nil || len(blockers) > 0 {
+		t.Fatalf("blockers = %v, %v, want none", blockers, err)
+	}
+
+	f.statements = nil
+	if err := PurgeRecords(db.DB, userType, userID); err != nil {
+		t.Fatal(err)
+	}
+	var writes []string
+	for _, s := range f.statements {
+		words := strings.Fields(strings.Replace(s.query, "DELETE FROM", "DELETE", 1))
+		if words[0] == "UPDATE" || words[0] == "DELETE" {
+			writes = append(writes, words[0]+" "+words[1])
+		}
+	}
+	want := []string{
+		`UPDATE "coupon_redemptions"`,
+		`DELETE "subscriptions"`,
+		`DELETE "usage_events"`,
+		`DELETE "users"`,
+	}
+	if !reflect.DeepEqual(writes, want) {
+		t.Fatalf("writes = %v, want %v", writes, want)
+	}
+	values := statementValues(f.find(`UPDATE "coupon_redemptions"`)[0])
+	if value, ok := values["subscription_id"]; !ok || value != nil {
+		t.Fatalf("nullified subscription_id = %v, %v", value, ok)
+	}
+
+	if _, err := PurgeBlockers(db.DB, reflect.TypeOf(models.Coupon{}), uuid.New()); err == nil {
+		t.Fatal("purging a model without purge references must fail")
+	}
+}
@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"platform/backend/config"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func init() {
+	// The plan binding rule accepts the keys of config.Plans
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterValidation("plan", func(fl validator.FieldLevel) bool {
+			_, ok := config.Plans[fl.Field().String()]
+			return ok
+		})
+	}
+}
+
+// FieldErrors maps the JSON name of a field to what is wrong with its value
+type FieldErrors map[string]string
+
+var (
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// ApplyAdminValues sets the fields of record named by the JSON keys of data,
+// converting each value to the field type and checking it against the
+// field's binding rules. Read-only fields may only be sent unchanged.
+func ApplyAdminValues(metadata *ResourceMetadata, record reflect.Value, data map[string]interface{}) FieldErrors {
+	errs := FieldErrors{}
+	var changed []FieldMetadata
+
+	for key, value := range data {
+		field, ok := metadata.Field(key)
+		if !ok {
+			errs[key] = "is not a field of " + metadata.Name
+			continue
+		}
+
+		target := record.FieldByIndex(field.Index)
+		converted, err := coerceAdminValue(value, target.Type())
+
+		if !field.Editable {
+			if err != nil || !sameValue(converted, target) {
+				errs[key] = "is read-only"
+			}
+			continue
+		}
+		if err != nil {
+			errs[key] = err.Error()
+			continue
+		}
+
+		target.Set(converted)
+		changed = append(changed, field)
+	}
+
+	for _, field := range changed {
+		validateAdminField(field, record, errs)
+	}
+	return errs
+}
+
+// ValidateAdminRecord checks every field of record against its binding rules
+func ValidateAdminRecord(metadata *ResourceMetadata, record reflect.Value) FieldErrors {
+	errs := FieldErrors{}
+	for _, field := range metadata.Fields {
+		validateAdminField(field, record, errs)
+	}
+	return errs
+}
+
+func validateAdminField(field FieldMetadata, record reflect.Value, errs FieldErrors) {
+	if _, failed := errs[field.Name]; failed {
+		return
+	}
+
+	value := record.FieldByIndex(field.Index)
+	if len(field.Options) > 0 && value.Kind() == reflect.String && value.String() != "" &&
+		!contains(field.Options, value.String()) {
+		errs[field.Name] = "must be one of " + strings.Join(field.Options, ", ")
+		return
+	}
+	if field.Validation == "" {
+		return
+	}
+
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	err := validate.Var(value.Interface(), field.Validation)
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) && len(invalid) > 0 {
+		errs[field.Name] = validationMessage(invalid[0])
+	} else if err != nil {
+		errs[field.Name] = err.Error()
+	}
+}
+
+func validationMessage(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(err.Param()), ", ")
+	case "plan":
+		return "must be one of " + strings.Join(config.PlanKeys(), ", ")
+	case "min":
+		return "must be at least " + err.Param()
+	case "max":
+		return "must be at most " + err.Param()
+	default:
+		return "does not satisfy " + err.Tag()
+	}
+}
+
+// coerceAdminValue converts a decoded JSON value to t. Strings are accepted
+// for UUIDs, times, numbers and booleans as form inputs send them that way.
+func coerceAdminValue(value interface{}, t reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, errors.New("cannot be null")
+	}
+
+	if t.Kind() == reflect.Ptr {
+		// Forms clear optional values by sending an empty string
+		if value == "" && t.Elem().Kind() != reflect.String {
+			return reflect.Zero(t), nil
+		}
+		elem, err := coerceAdminValue(value, t.Elem())
+		if err != nil {
+			return elem, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+
+	s, isString := value.(string)
+
+	switch {
+	case t == uuidType:
+		id, err := uuid.Parse(s)
+		if !isString || err != nil {
+			return reflect.Value{}, errors.New("must be a UUID")
+		}
+		return reflect.ValueOf(id), nil
+
+	case t == timeType:
+		if isString {
+			if at, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return reflect.ValueOf(at), nil
+			}
+			if at, err := time.Parse(time.DateOnly, s); err == nil {
+				return reflect.ValueOf(at), nil
+			}
+		}
+		return reflect.Value{}, errors.New("must be an RFC 3339 timestamp or a date")
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if !isString {
+			return reflect.Value{}, errors.New("must be a string")
+		}
+		return reflect.ValueOf(s).Convert(t), nil
+
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if isString {
+			parsed, err := strconv.ParseBool(s)
+			b, ok = parsed, err == nil
+		}
+		if !ok {
+			return reflect.Value{}, errors.New("must be true or false")
+		}
+		return reflect.ValueOf(b).Convert(t), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := numberValue(value)
+		if err != nil || n != math.Trunc(n) {
+			return reflect.Value{}, errors.New("must be a whole number")
+		}
+		v := reflect.New(t).Elem()
+		if t.Kind() >= reflect.Uint {
+			if n < 0 || v.OverflowUint(uint64(n)) {
+				return reflect.Value{}, errors.New("is out of range")
+			}
+			v.SetUint(uint64(n))
+		} else {
+			if v.OverflowInt(int64(n)) {
+				return reflect.Value{}, errors.New("is out of range")
+			}
+			v.SetInt(int64(n))
+		}
+		return v, nil
+
+	case reflect.Float32, reflect.Float64:
+		n, err := numberValue(value)
+		if err != nil {
+			return reflect.Value{}, errors.New("must be a number")
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+	}
+
+	// Structured values such as JSON columns decode through their tags
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+		return reflect.Value{}, errors.New("has an invalid value")
+	}
+	return ptr.Elem(), nil
+}
+
+func numberValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, errors.New("not a number")
+}
+
+// sameValue reports whether a converted value equals the current field value
+func sameValue(converted, current reflect.Value) bool {
+	if !converted.IsValid() {
+		return false
+	}
+	a, b := converted.Interface(), current.Interface()
+	if at, ok := a.(time.Time); ok {
+		bt, _ := b.(time.Time)
+		return at.Equal(bt)
+	}
+	if at, ok := a.(*time.Time); ok {
+		bt, _ := b.(*time.Time)
+		return (at == nil && bt == nil) || (at != nil && bt != nil && at.Equal(*bt))
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"platform/backend/config"
+)
+
+type planTestRecord struct {
+	Plan string `json:"plan" binding:"plan"`
+}
+
+func TestPlanValidation(t *testing.T) {
+	config.Plans["team"] = config.Plan{Key: "team", Name: "Team"}
+	defer delete(config.Plans, "team")
+
+	metadata := &ResourceMetadata{Fields: extractFields(reflect.TypeOf(planTestRecord{}), nil)}
+	field, _ := metadata.Field("plan")
+	if want := config.PlanKeys(); !reflect.DeepEqual(field.Options, want) {
+		t.Errorf("options %v, want %v", field.Options, want)
+	}
+
+	tests := []struct {
+		plan, err string
+	}{
+		{config.PlanFree, ""},
+		{"team", ""},
+		{"gold", "must be one of free, pro, team"},
+		{"", "must be one of free, pro, team"},
+	}
+	for _, tt := range tests {
+		record := planTestRecord{Plan: tt.plan}
+		errs := ValidateAdminRecord(metadata, reflect.ValueOf(record))
+		if errs["plan"] != tt.err {
+			t.Errorf("plan %q: got %q, want %q", tt.plan, errs["plan"], tt.err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/db"
+	"platform/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditActor identifies who made a change and from where
+type AuditActor struct {
+	ID        *uuid.UUID
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+// AuditSnapshot is the JSON encoding of each field of a record, so fields
+// hidden from JSON never reach the audit log
+type AuditSnapshot map[string]json.RawMessage
+
+// AuditActorOf returns the authenticated user and request details of c
+func AuditActorOf(c *gin.Context) AuditActor {
+	actor := AuditActor{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: c.GetString("requestID"),
+	}
+	if value, ok := c.Get("userID"); ok {
+		if id, ok := value.(uuid.UUID); ok && id != uuid.Nil {
+			actor.ID = &id
+		}
+	}
+	return actor
+}
+
+// SnapshotRecord captures record before or after a change
+func SnapshotRecord(record interface{}) AuditSnapshot {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil
+	}
+	var snapshot AuditSnapshot
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// Audit appends an entry for a change to the audit log through tx. before is
+// nil for created records and after for deleted ones. Updates that changed
+// nothing are not logged.
+func Audit(tx *gorm.DB, actor AuditActor, action, resource, recordID string, before, after AuditSnapshot) error {
+	changes := auditDiff(before, after)
+	if len(changes) == 0 && before != nil && after != nil {
+		return nil
+	}
+	return tx.Create(auditEntry(actor, action, resource, recordID, changes)).Error
+}
+
+// AuditAction logs a custom admin action with the changes it made to the
+// record and its result. Actions are logged even when nothing changed.
+func AuditAction(tx *gorm.DB, actor AuditActor, action, resource, recordID string, before, after AuditSnapshot, result any) error {
+	entry := auditEntry(actor, action, resource, recordID, auditDiff(before, after))
+	if result != nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		entry.Result = raw
+	}
+	return tx.Create(entry).Error
+}
+
+func auditEntry(actor AuditActor, action, resource, recordID string, changes map[string]models.AuditChange) *models.AuditLog {
+	return &models.AuditLog{
+		ActorID:   actor.ID,
+		Action:    action,
+		Resource:  resource,
+		RecordID:  recordID,
+		Changes:   changes,
+		IP:        actor.IP,
+		UserAgent: actor.UserAgent,
+		RequestID: actor.RequestID,
+	}
+}
+
+// auditDiff returns the fields that differ, leaving out updatedAt which every
+// save changes
+func auditDiff(before, after AuditSnapshot) map[string]models.AuditChange {
+	changes := make(map[string]models.AuditChange)
+	for field, value := range after {
+		if field != "updatedAt" && !bytes.Equal(before[field], value) {
+			changes[field] = models.AuditChange{Before: before[field], After: value}
+		}
+	}
+	for field, value := range before {
+		if _, ok := after[field]; !ok {
+			changes[field] = models.AuditChange{Before: value}
+		}
+	}
+	return changes
+}
+
+// PurgeAuditLog deletes entries older than config.GetAuditRetentionDays
+func PurgeAuditLog(now time.Time) error {
+	days := config.GetAuditRetentionDays()
+	if days == 0 {
+		return nil
+	}
+
+	// Entries refuse deletion through hooks; retention is the one exception
+	result := db.DB.Session(&gorm.Session{SkipHooks: true}).
+		Where("created_at < ?", now.AddDate(0, 0, -days)).
+		Delete(&models.AuditLog{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Purged %d audit log entries older than %d days", result.RowsAffected, days)
+	}
+	return nil
+}
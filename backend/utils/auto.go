@@ -1,73 +1,251 @@
 package utils
 
 import (
+	"errors"
+
+	"platform/backend/db"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func AutoHandler[T any](action string, name string) gin.HandlerFunc {
+// CrudOptions configures the handlers built by Crud
+type CrudOptions[T any] struct {
+	// OwnerColumn holds the ID of the user who owns a record, e.g. user_id.
+	// Lists leave out records of other users and fetching them answers 404.
+	// Admins see every record.
+	OwnerColumn string
+	// Permissions maps an action (list, get, create, update or delete) to
+	// the role it requires. Actions without a role are open to every user.
+	Permissions map[string]string
+	// Middleware maps an action to handlers that run before it
+	Middleware map[string]gin.HandlersChain
+
+	// Hooks run inside the transaction of the change; CrudTx returns it. An
+	// error rolls the change back and answers 400 with its message, or with
+	// the status of an HTTPError.
+	BeforeCreate func(c *gin.Context, item *T) error
+	AfterCreate  func(c *gin.Context, item *T) error
+	BeforeUpdate func(c *gin.Context, old, new *T) error
+	AfterUpdate  func(c *gin.Context, old, new *T) error
+	BeforeDelete func(c *gin.Context, item *T) error
+	AfterDelete  func(c *gin.Context, item *T) error
+}
+
+const crudTxKey = "crudTx"
+
+// CrudTx returns the transaction a Crud hook runs in
+func CrudTx(c *gin.Context) *gorm.DB {
+	if tx, ok := c.Get(crudTxKey); ok {
+		return tx.(*gorm.DB)
+	}
+	return db.DB.WithContext(c)
+}
+
+// authorize responds 403 unless the current user may run action
+func (o CrudOptions[T]) authorize(c *gin.Context, action string) {
+	if role := o.Permissions[action]; role != "" {
+		RequireRole(c, role)
+	}
+}
+
+// scopes return the query scopes limiting records to those the current user
+// owns
+func (o CrudOptions[T]) scopes(c *gin.Context) []func(*gorm.DB) *gorm.DB {
+	if o.OwnerColumn == "" || IsAdmin(c) {
+		return nil
+	}
+	userID := RequireAuth(c)
+	return []func(*gorm.DB) *gorm.DB{func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(clause.Eq{Column: clause.Column{Name: o.OwnerColumn}, Value: userID})
+	}}
+}
+
+// chain puts the action's middleware in front of handler
+func (o CrudOptions[T]) chain(action string, handler gin.HandlerFunc) gin.HandlersChain {
+	return append(append(gin.HandlersChain{}, o.Middleware[action]...), handler)
+}
+
+// crudTransaction runs fn in a transaction that hooks reach through CrudTx
+func crudTransaction(c *gin.Context, fn func(tx *gorm.DB) error) {
+	err := Transaction(c, func(tx *gorm.DB) error {
+		c.Set(crudTxKey, tx)
+		defer delete(c.Keys, crudTxKey)
+		return fn(tx)
+	})
+	Check(err == nil)
+}
+
+// uniqueConflict answers the violation of a unique index, which a hook that
+// checked for duplicates may race with, with 409 and message
+func uniqueConflict(tx *gorm.DB, err error, message string) error {
+	if IsUniqueViolation(tx, err) {
+		return NewHTTPError(StatusConflict, message)
+	}
+	return err
+}
+
+// hookError answers plain hook errors with 400
+func hookError(err error) error {
+	var httpErr *HTTPError
+	if err == nil || errors.As(err, &httpErr) {
+		return err
+	}
+	return NewHTTPError(StatusBadRequest, err.Error())
+}
+
+func AutoHandler[T any](action string, name string, options CrudOptions[T]) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		H(c, func() {
+			options.authorize(c, action)
 			switch action {
 			case "get":
-				RestGet[T](c, name)
+				RestGet[T](c, name, options.scopes(c)...)
 			case "delete":
-				RestDelete[T](c, name)
+				item := FetchByParam[T](c, "id", options.scopes(c)...)
+				CheckIfMatch(c, &item)
+				crudTransaction(c, func(tx *gorm.DB) error {
+					if options.BeforeDelete != nil {
+						if err := options.BeforeDelete(c, &item); err != nil {
+							return hookError(err)
+						}
+					}
+					if err := DeleteIfUnchanged(tx, &item); err != nil {
+						return err
+					}
+					if options.AfterDelete != nil {
+						return hookError(options.AfterDelete(c, &item))
+					}
+					return nil
+				})
+				CrudSuccess(c, "delete", name, nil)
 			case "list":
-				items := Try(All[T]())
-				RestList[T](c, name+"s", items)
+				RestQuery[T](c, name+"s", options.scopes(c)...)
 			}
 		})
 	}
 }
 
-func AutoUpdateHandler[T any, R any](name string) gin.HandlerFunc {
+func AutoUpdateHandler[T any, R any](name string, options CrudOptions[T]) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		H(c, func() {
-			RestUpdate[T, R](c, name)
+			options.authorize(c, "update")
+			item := FetchByParam[T](c, "id", options.scopes(c)...)
+			CheckIfMatch(c, &item)
+			req := Get(BindAndValidate[R](c))
+
+			old := item
+			AutoUpdate(&item, req)
+			options.update(c, name, &old, &item)
 		})
 	}
 }
 
-func AutoCreate[T any, R any](name string, onCreate func(*R, uuid.UUID) *T) gin.HandlerFunc {
+// AutoPatchHandler updates the fields of the update request R with a JSON
+// Merge Patch or a JSON Patch, see PatchValues. It runs the update hooks and
+// middleware.
+func AutoPatchHandler[T any, R any](name string, options CrudOptions[T]) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		H(c, func() {
+			options.authorize(c, "update")
+			item := FetchByParam[T](c, "id", options.scopes(c)...)
+			CheckIfMatch(c, &item)
+			values := Get(PatchValues[R](c, &item))
+
+			old := item
+			ApplyFieldValues(&item, values)
+			options.update(c, name, &old, &item)
+		})
+	}
+}
+
+// update saves the changes from old to item with the update hooks, unless
+// the record changed since it was fetched
+func (o CrudOptions[T]) update(c *gin.Context, name string, old, item *T) {
+	crudTransaction(c, func(tx *gorm.DB) error {
+		if o.BeforeUpdate != nil {
+			if err := o.BeforeUpdate(c, old, item); err != nil {
+				return hookError(err)
+			}
+		}
+		if err := SaveIfUnchanged(tx, item); err != nil {
+			return uniqueConflict(tx, err, capitalize(name)+" conflicts with another "+name)
+		}
+		if o.AfterUpdate != nil {
+			return hookError(o.AfterUpdate(c, old, item))
+		}
+		return nil
+	})
+	SetETag(c, item)
+	CrudSuccess(c, "update", name, item)
+}
+
+func AutoCreate[T any, R any](name string, onCreate func(*R, uuid.UUID) *T, options CrudOptions[T]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		H(c, func() {
+			options.authorize(c, "create")
 			req := Get(BindAndValidate[R](c))
 			userID := RequireAuth(c)
 			item := onCreate(req, userID)
-			RestCreate(c, name, item, StatusCreated)
+
+			crudTransaction(c, func(tx *gorm.DB) error {
+				if options.BeforeCreate != nil {
+					if err := options.BeforeCreate(c, item); err != nil {
+						return hookError(err)
+					}
+				}
+				if err := tx.Create(item).Error; err != nil {
+					return uniqueConflict(tx, err, capitalize(name)+" already exists")
+				}
+				if options.AfterCreate != nil {
+					return hookError(options.AfterCreate(c, item))
+				}
+				return nil
+			})
+			CrudSuccess(c, "create", name, item)
 		})
 	}
 }
 
+// Crud builds list, get, create, update, patch and delete handler chains for
+// Route. Patches share the update permission, middleware and hooks.
+// The factory onCreate receives the ID of the user creating the record, which
+// it should store in the owner column.
 func Crud[T any, CreateReq any, UpdateReq any](
 	name string,
 	onCreate func(*CreateReq, uuid.UUID) *T,
-) map[string]gin.HandlerFunc {
-	return map[string]gin.HandlerFunc{
-		"list":   AutoHandler[T]("list", name),
-		"get":    AutoHandler[T]("get", name),
-		"create": AutoCreate[T, CreateReq](name, onCreate),
-		"update": AutoUpdateHandler[T, UpdateReq](name),
-		"delete": AutoHandler[T]("delete", name),
+	options CrudOptions[T],
+) map[string]gin.HandlersChain {
+	return map[string]gin.HandlersChain{
+		"list":   options.chain("list", AutoHandler[T]("list", name, options)),
+		"get":    options.chain("get", AutoHandler[T]("get", name, options)),
+		"create": options.chain("create", AutoCreate[T, CreateReq](name, onCreate, options)),
+		"update": options.chain("update", AutoUpdateHandler[T, UpdateReq](name, options)),
+		"patch":  options.chain("update", AutoPatchHandler[T, UpdateReq](name, options)),
+		"delete": options.chain("delete", AutoHandler[T]("delete", name, options)),
 	}
 }
 
-func Route(router *gin.RouterGroup, path string, handlers map[string]gin.HandlerFunc) {
+func Route(router *gin.RouterGroup, path string, handlers map[string]gin.HandlersChain) {
 	group := router.Group(path)
 	if h, ok := handlers["list"]; ok {
-		group.GET("", h)
+		group.GET("", h...)
 	}
 	if h, ok := handlers["create"]; ok {
-		group.POST("", h)
+		group.POST("", h...)
 	}
 	if h, ok := handlers["get"]; ok {
-		group.GET("/:id", h)
+		group.GET("/:id", h...)
 	}
 	if h, ok := handlers["update"]; ok {
-		group.PUT("/:id", h)
+		group.PUT("/:id", h...)
+	}
+	if h, ok := handlers["patch"]; ok {
+		group.PATCH("/:id", h...)
 	}
 	if h, ok := handlers["delete"]; ok {
-		group.DELETE("/:id", h)
+		group.DELETE("/:id", h...)
 	}
 }
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// commitHooks holds the functions to run once a transaction begun by
+// RunTransaction commits
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+type commitHooksKey struct{}
+
+// withCommitHooks returns a context for a transaction and the function that
+// runs what AfterCommit deferred, to be called after the commit
+func withCommitHooks(ctx context.Context) (context.Context, func()) {
+	hooks := &commitHooks{}
+	return context.WithValue(ctx, commitHooksKey{}, hooks), func() {
+		hooks.mu.Lock()
+		fns := hooks.fns
+		hooks.fns = nil
+		hooks.mu.Unlock()
+		for _, fn := range fns {
+			fn()
+		}
+	}
+}
+
+// AfterCommit runs fn once the transaction tx belongs to commits, and never
+// if it rolls back. Outside of a transaction fn runs right away, and so it
+// does in transactions not begun by Transaction or RunTransaction, which
+// cannot defer it.
+func AfterCommit(tx *gorm.DB, fn func()) {
+	if _, inTransaction := tx.Statement.ConnPool.(gorm.TxCommitter); inTransaction {
+		if hooks, ok := tx.Statement.Context.Value(commitHooksKey{}).(*commitHooks); ok {
+			hooks.mu.Lock()
+			hooks.fns = append(hooks.fns, fn)
+			hooks.mu.Unlock()
+			return
+		}
+	}
+	fn()
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,18 +10,34 @@ import (
 type HTTPStatus int
 
 const (
-	StatusOK           HTTPStatus = http.StatusOK
-	StatusCreated      HTTPStatus = http.StatusCreated
-	StatusBadRequest   HTTPStatus = http.StatusBadRequest
-	StatusUnauthorized HTTPStatus = http.StatusUnauthorized
-	StatusNotFound     HTTPStatus = http.StatusNotFound
-	StatusConflict     HTTPStatus = http.StatusConflict
-	StatusError        HTTPStatus = http.StatusInternalServerError
+	StatusOK                 HTTPStatus = http.StatusOK
+	StatusCreated            HTTPStatus = http.StatusCreated
+	StatusBadRequest         HTTPStatus = http.StatusBadRequest
+	StatusUnauthorized       HTTPStatus = http.StatusUnauthorized
+	StatusPaymentRequired    HTTPStatus = http.StatusPaymentRequired
+	StatusForbidden          HTTPStatus = http.StatusForbidden
+	StatusNotFound           HTTPStatus = http.StatusNotFound
+	StatusConflict           HTTPStatus = http.StatusConflict
+	StatusPreconditionFailed HTTPStatus = http.StatusPreconditionFailed
+	StatusUnsupportedType    HTTPStatus = http.StatusUnsupportedMediaType
+	StatusUnprocessable      HTTPStatus = http.StatusUnprocessableEntity
+	StatusTooManyRequests    HTTPStatus = http.StatusTooManyRequests
+	StatusError              HTTPStatus = http.StatusInternalServerError
 )
 
+// Respond writes the JSON response. Successful GET responses of routes that
+// enabled it, or with an ETag set by the handler, answer conditional
+// requests, see EnableConditional and WriteConditional.
 func Respond(c *gin.Context, status HTTPStatus, message string, data gin.H) {
 	if status >= 400 {
 		c.JSON(int(status), Response{Success: false, Error: message})
+	} else if isConditional(c) {
+		body, err := json.Marshal(Response{Success: true, Message: message, Data: data})
+		if err != nil {
+			RespondWithError(c, StatusError, err, "Internal server error")
+			return
+		}
+		WriteConditional(c, status, body)
 	} else {
 		c.JSON(int(status), Response{Success: true, Message: message, Data: data})
 	}
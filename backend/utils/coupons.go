@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidPromotionCode = errors.New("invalid promotion code")
+
+// ValidatePromotionCode checks that code can be redeemed by user for plan
+func ValidatePromotionCode(tx *gorm.DB, code, planKey string, user models.User) (models.PromotionCode, models.Coupon, error) {
+	var promo models.PromotionCode
+	var coupon models.Coupon
+	now := time.Now().UTC()
+
+	invalid := func(reason string) (models.PromotionCode, models.Coupon, error) {
+		return promo, coupon, fmt.Errorf("%w: %s", ErrInvalidPromotionCode, reason)
+	}
+
+	err := tx.Where("code = ?", normalizeCode(code)).First(&promo).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return invalid("code not found")
+	}
+	if err != nil {
+		return promo, coupon, err
+	}
+	if err := tx.First(&coupon, "id = ?", promo.CouponID).Error; err != nil {
+		return promo, coupon, err
+	}
+
+	switch {
+	case !promo.Active:
+		return invalid("code is no longer active")
+	case promo.ExpiresAt != nil && promo.ExpiresAt.Before(now),
+		coupon.ExpiresAt != nil && coupon.ExpiresAt.Before(now):
+		return invalid("code has expired")
+	case promo.MaxRedemptions > 0 && promo.TimesRedeemed >= promo.MaxRedemptions,
+		coupon.MaxRedemptions > 0 && coupon.TimesRedeemed >= coupon.MaxRedemptions:
+		return invalid("code has been fully redeemed")
+	case len(coupon.Plans) > 0 && !contains(coupon.Plans, planKey):
+		return invalid("code does not apply to the " + config.GetPlan(planKey).Name + " plan")
+	case coupon.AmountOff > 0 && coupon.Currency != "" && coupon.Currency != config.GetCurrency():
+		return invalid("code is not valid in " + config.GetCurrency())
+	}
+
+	// A coupon can be redeemed once per organization, or per user without one
+	redeemed := tx.Model(&models.CouponRedemption{}).Where("coupon_id = ?", coupon.ID)
+	if user.OrganizationID != nil {
+		redeemed = redeemed.Where("organization_id = ?", *user.OrganizationID)
+	} else {
+		redeemed = redeemed.Where("user_id = ?", user.ID)
+	}
+	var count int64
+	if err := redeemed.Count(&count).Error; err != nil {
+		return promo, coupon, err
+	}
+	if count > 0 {
+		return invalid("code has already been redeemed")
+	}
+
+	return promo, coupon, nil
+}
+
+// RedeemPromotionCode applies a promotion code for planKey, the plan the
+// subscription checks out, to the subscription, replacing any discount it
+// already had
+func RedeemPromotionCode(tx *gorm.DB, sub models.Subscription, user models.User, code, planKey string) (*models.CouponRedemption, error) {
+	// Lock the code and its coupon so concurrent redemptions cannot exceed
+	// their redemption limits
+	var locked models.PromotionCode
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", normalizeCode(code)).First(&locked).Error
+	if err == nil {
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Coupon{}, "id = ?", locked.CouponID).Error
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	promo, coupon, err := ValidatePromotionCode(tx, code, planKey, user)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	err = tx.Model(&models.CouponRedemption{}).
+		Where("subscription_id = ? AND ended_at IS NULL", sub.ID).
+		Update("ended_at", now).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&promo).Update("times_redeemed", gorm.Expr("times_redeemed + 1")).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&coupon).Update("times_redeemed", gorm.Expr("times_redeemed + 1")).Error; err != nil {
+		return nil, err
+	}
+
+	redemption := &models.CouponRedemption{
+		CouponID:        coupon.ID,
+		PromotionCodeID: &promo.ID,
+		SubscriptionID:  sub.ID,
+		UserID:          user.ID,
+		OrganizationID:  user.OrganizationID,
+	}
+	return redemption, tx.Create(redemption).Error
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CouponDiscount returns the discount of coupon on a subtotal
+func CouponDiscount(coupon models.Coupon, subtotal int64) int64 {
+	if subtotal <= 0 {
+		return 0
+	}
+	if coupon.PercentOff > 0 {
+		return int64(math.Round(float64(subtotal) * coupon.PercentOff / 100))
+	}
+	if coupon.AmountOff > subtotal {
+		return subtotal
+	}
+	return coupon.AmountOff
+}
+
+// ApplyDiscount adds the discount line of the subscription's active coupon
+// and counts the period against the coupon duration
+func ApplyDiscount(tx *gorm.DB, sub models.Subscription, lines []models.InvoiceLine) ([]models.InvoiceLine, error) {
+	var redemption models.CouponRedemption
+	err := tx.Where("subscription_id = ? AND ended_at IS NULL", sub.ID).First(&redemption).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return lines, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var coupon models.Coupon
+	if err := tx.First(&coupon, "id = ?", redemption.CouponID).Error; err != nil {
+		return nil, err
+	}
+
+	var subtotal int64
+	for _, line := range lines {
+		subtotal += line.Amount
+	}
+	if subtotal <= 0 {
+		return lines, nil
+	}
+
+	if discount := CouponDiscount(coupon, subtotal); discount > 0 {
+		lines = append(lines, models.InvoiceLine{
+			Description: "Discount: " + coupon.Name,
+			Quantity:    1,
+			UnitAmount:  -discount,
+			Amount:      -discount,
+		})
+	}
+
+	redemption.PeriodsApplied++
+	if coupon.Duration == config.CouponDurationOnce ||
+		(coupon.Duration == config.CouponDurationRepeating && redemption.PeriodsApplied >= coupon.DurationInPeriods) {
+		now := time.Now().UTC()
+		redemption.EndedAt = &now
+	}
+	return lines, tx.Save(&redemption).Error
+}
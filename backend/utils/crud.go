@@ -5,25 +5,38 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
-func RestGet[T any](c *gin.Context, name string) {
-	resource := FetchByParam[T](c, "id")
+func RestGet[T any](c *gin.Context, name string, scopes ...func(*gorm.DB) *gorm.DB) {
+	resource := FetchByParam[T](c, "id", scopes...)
+	SetETag(c, &resource)
 	Respond(c, StatusOK, "", gin.H{name: resource})
 }
 
-func RestUpdate[T any, R any](c *gin.Context, name string) {
-	resource := FetchByParam[T](c, "id")
+// RestUpdate updates the record named by the id parameter from the request
+// body R.
+//
+// Deprecated: Use Crud, whose update and patch handlers run in a transaction
+// with hooks and answer unique violations with 409.
+func RestUpdate[T any, R any](c *gin.Context, name string, scopes ...func(*gorm.DB) *gorm.DB) {
+	resource := FetchByParam[T](c, "id", scopes...)
+	CheckIfMatch(c, &resource)
 	req := Get(BindAndValidate[R](c))
 
 	AutoUpdate(&resource, req)
 
 	TryErr(HandleCRUD(c, "update", &resource, name))
+	SetETag(c, &resource)
 	CrudSuccess(c, "update", name, resource)
 }
 
-func RestDelete[T any](c *gin.Context, name string) {
-	resource := FetchByParam[T](c, "id")
+// RestDelete deletes the record named by the id parameter.
+//
+// Deprecated: Use Crud, whose delete handler runs in a transaction with hooks.
+func RestDelete[T any](c *gin.Context, name string, scopes ...func(*gorm.DB) *gorm.DB) {
+	resource := FetchByParam[T](c, "id", scopes...)
+	CheckIfMatch(c, &resource)
 	TryErr(HandleCRUD(c, "delete", &resource, name))
 	CrudSuccess(c, "delete", name, nil)
 }
@@ -32,6 +45,64 @@ func RestList[T any](c *gin.Context, name string, items []T) {
 	Respond(c, StatusOK, "", gin.H{name: items})
 }
 
+// RestQuery responds with a page of the records matching the list parameters
+// of the request, see ParseListQuery. The fields and associations the
+// parameters may name are those QueryFields whitelists for T. Cursor pages
+// are linked through the Link header as well.
+func RestQuery[T any](c *gin.Context, name string, scopes ...func(*gorm.DB) *gorm.DB) {
+	columns, includes := QueryFields(new(T))
+	query, err := ParseListQuery(c, new(T), columns)
+	if err != nil {
+		Respond(c, StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	filter := func(tx *gorm.DB) *gorm.DB {
+		return query.Filter(tx.Model(new(T)).Scopes(scopes...))
+	}
+
+	var total int64
+	var tx *gorm.DB
+	if query.Keyset {
+		if _, ok := columns["createdAt"]; !ok {
+			Respond(c, StatusBadRequest, "cursor pagination needs createdAt and id", nil)
+			return
+		}
+		tx = query.Seek(filter(db.DB))
+	} else {
+		TryErr(filter(db.DB).Count(&total).Error)
+		tx = query.Paginate(query.Order(filter(db.DB)))
+	}
+
+	for _, include := range query.Include {
+		association, ok := includes[include]
+		if !ok {
+			Respond(c, StatusBadRequest, "cannot include "+include, nil)
+			return
+		}
+		tx = tx.Preload(association)
+	}
+
+	items := []T{}
+	TryErr(tx.Find(&items).Error)
+
+	var pagination any = query.Pagination(total)
+	if query.Keyset {
+		cursors := query.CursorPage(&items)
+		SetLinkHeader(c, cursors)
+		pagination = cursors
+	}
+
+	Respond(c, StatusOK, "", gin.H{
+		name:         Try(query.Project(items)),
+		"pagination": pagination,
+	})
+}
+
+// RestCreate creates item.
+//
+// Deprecated: Use Crud, whose create handler runs in a transaction with hooks
+// and answers unique violations with 409.
 func RestCreate[T any](c *gin.Context, name string, item *T, status HTTPStatus) {
 	TryErr(HandleCRUD(c, "create", item, name))
 	CrudSuccess(c, "create", name, item)
@@ -42,7 +113,13 @@ func FindByIDGeneric(model interface{}, id uuid.UUID) error {
 	return db.DB.First(model, "id = ?", id).Error
 }
 
-// SaveGeneric saves a record for any model type (used with reflection)
+// CreateGeneric creates a record for any model type (used with reflection)
+func CreateGeneric(model interface{}) error {
+	return db.DB.Create(model).Error
+}
+
+// SaveGeneric saves a record for any model type (used with reflection).
+// SaveIfUnchanged saves it only if it did not change since it was read.
 func SaveGeneric(model interface{}) error {
 	return db.DB.Save(model).Error
 }
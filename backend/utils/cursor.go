@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidCursor = errors.New("invalid cursor")
+	errCursorScope   = errors.New("cursor belongs to another list or filters")
+)
+
+// Cursor is a position in a list ordered by created_at and id, newest first.
+// Clients receive it as an opaque signed token, so they cannot forge one.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"i"`
+	// Before pages towards newer records, ending just before the position
+	Before bool `json:"b,omitempty"`
+	// Scope identifies the list the cursor pages, see listScope
+	Scope string `json:"s"`
+}
+
+// CursorPagination describes a page of a cursor paginated list. A cursor is
+// empty when there are no records in its direction.
+type CursorPagination struct {
+	PageSize   int    `json:"pageSize"`
+	NextCursor string `json:"nextCursor"`
+	PrevCursor string `json:"prevCursor"`
+}
+
+// Encode returns the token of the cursor, its JSON and an HMAC of it keyed
+// with the JWT secret
+func (cur Cursor) Encode() string {
+	payload, _ := json.Marshal(cur)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + cursorSignature(encoded)
+}
+
+// DecodeCursor verifies and decodes a token returned by Encode
+func DecodeCursor(token string) (Cursor, error) {
+	var cur Cursor
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(cursorSignature(encoded))) {
+		return cur, errInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cur, errInvalidCursor
+	}
+	if err := json.Unmarshal(payload, &cur); err != nil {
+		return cur, errInvalidCursor
+	}
+	return cur, nil
+}
+
+func cursorSignature(encoded string) string {
+	mac := hmac.New(sha256.New, []byte("cursor:"+getJWTSecret()))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Seek limits the query to the page after the query's cursor, or before it
+// for cursors that page backwards, fetching one extra record to tell whether
+// more follow. Models must have created_at and id columns, as those
+// embedding models.BaseModel do.
+func (q ListQuery) Seek(tx *gorm.DB) *gorm.DB {
+	order := "created_at DESC, id DESC"
+	if cur := q.Cursor; cur != nil {
+		if cur.Before {
+			tx = tx.Where("(created_at, id) > (?, ?)", cur.CreatedAt, cur.ID)
+			order = "created_at, id"
+		} else {
+			tx = tx.Where("(created_at, id) < (?, ?)", cur.CreatedAt, cur.ID)
+		}
+	}
+	return tx.Order(order).Limit(q.PageSize + 1)
+}
+
+// CursorPage trims items, a pointer to the slice Seek fetched, to the page
+// and returns the cursors of the pages next to it. Items read backwards are
+// put back in list order.
+func (q ListQuery) CursorPage(items any) CursorPagination {
+	slice := reflect.ValueOf(items).Elem()
+	more := slice.Len() > q.PageSize
+	if more {
+		slice.Set(slice.Slice(0, q.PageSize))
+	}
+
+	backwards := q.Cursor != nil && q.Cursor.Before
+	if backwards {
+		swap := reflect.Swapper(slice.Interface())
+		for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	pagination := CursorPagination{PageSize: q.PageSize}
+	if slice.Len() == 0 {
+		return pagination
+	}
+	if more || backwards {
+		pagination.NextCursor = q.cursorAt(slice.Index(slice.Len()-1), false).Encode()
+	}
+	if (more && backwards) || (!backwards && q.Cursor != nil) {
+		pagination.PrevCursor = q.cursorAt(slice.Index(0), true).Encode()
+	}
+	return pagination
+}
+
+func (q ListQuery) cursorAt(record reflect.Value, before bool) Cursor {
+	return Cursor{
+		CreatedAt: record.FieldByName("CreatedAt").Interface().(time.Time),
+		ID:        record.FieldByName("ID").Interface().(uuid.UUID),
+		Before:    before,
+		Scope:     q.scope,
+	}
+}
+
+// listScope hashes the path of a list and the parameters that choose its
+// records, so that a cursor only pages the list it was issued for
+func listScope(path string, q ListQuery) string {
+	filters := make([]string, len(q.Filters))
+	for i, f := range q.Filters {
+		filters[i] = f.Column + "\x00" + f.Op + "\x00" + f.Value
+	}
+	sort.Strings(filters)
+
+	hash := sha256.New()
+	for _, part := range append([]string{path, q.Search, q.Trashed}, filters...) {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0xff})
+	}
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// SetLinkHeader sets a Link header with the next and prev pages of a cursor
+// paginated list, as RFC 8288 describes
+func SetLinkHeader(c *gin.Context, pagination CursorPagination) {
+	var links []string
+	for _, page := range []struct{ rel, cursor string }{
+		{"next", pagination.NextCursor},
+		{"prev", pagination.PrevCursor},
+	} {
+		if page.cursor == "" {
+			continue
+		}
+		link := url.URL{Path: c.Request.URL.Path}
+		params := c.Request.URL.Query()
+		params.Set("cursor", page.cursor)
+		link.RawQuery = params.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, link.String(), page.rel))
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+}
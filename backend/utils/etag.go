@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPreconditionFailed refuses a change to a record that someone else
+// changed since the client read it
+var ErrPreconditionFailed = NewHTTPError(StatusPreconditionFailed, "The record was changed by someone else, reload it and try again")
+
+// RecordETag returns the entity tag of record, derived from its Version
+// column if it has one and from UpdatedAt otherwise. Records with neither
+// have no tag.
+func RecordETag(record any) string {
+	switch token := concurrencyToken(record); value := token.value.(type) {
+	case int64:
+		return `"v` + strconv.FormatInt(value, 10) + `"`
+	case time.Time:
+		// Postgres keeps microseconds, which the driver truncates to
+		return `"` + strconv.FormatInt(value.Truncate(time.Microsecond).UnixMicro(), 36) + `"`
+	}
+	return ""
+}
+
+// SetETag sets the ETag header to the entity tag of record, and the
+// Last-Modified header to its UpdatedAt
+func SetETag(c *gin.Context, record any) {
+	if tag := RecordETag(record); tag != "" {
+		c.Header("ETag", tag)
+	}
+	if f := reflect.Indirect(reflect.ValueOf(record)).FieldByName("UpdatedAt"); f.IsValid() {
+		if updatedAt, ok := f.Interface().(time.Time); ok {
+			SetLastModified(c, updatedAt)
+		}
+	}
+}
+
+// CheckIfMatch responds 412 and aborts when the request has an If-Match
+// header that does not list the entity tag of record. Requests without the
+// header change the record unconditionally.
+func CheckIfMatch(c *gin.Context, record any) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return
+	}
+	tag := RecordETag(record)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// Weak tags never match, as If-Match compares strongly
+		if candidate == "*" || (tag != "" && candidate == tag) {
+			return
+		}
+	}
+	Respond(c, StatusPreconditionFailed, ErrPreconditionFailed.Error(), nil)
+	Abort()
+}
+
+// SaveIfUnchanged saves record through tx unless another save changed it
+// since it was read, which fails with ErrPreconditionFailed. The Version
+// column of the record is incremented. Records without a Version or
+// UpdatedAt column are saved as they are.
+func SaveIfUnchanged(tx *gorm.DB, record any) error {
+	token := concurrencyToken(record)
+	if token.column == "" {
+		return tx.Save(record).Error
+	}
+	if version, ok := token.value.(int64); ok {
+		token.field.SetInt(version + 1)
+	}
+
+	// Selecting the columns keeps Save from inserting when no row matches
+	result := tx.Select("*").Where(token.condition()).Save(record)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrPreconditionFailed
+	}
+	return result.Error
+}
+
+// DeleteIfUnchanged deletes record through tx unless a save changed it since
+// it was read, which fails with ErrPreconditionFailed
+func DeleteIfUnchanged(tx *gorm.DB, record any) error {
+	token := concurrencyToken(record)
+	if token.column == "" {
+		return tx.Delete(record).Error
+	}
+
+	result := tx.Where(token.condition()).Delete(record)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrPreconditionFailed
+	}
+	return result.Error
+}
+
+// recordToken is the column of a record that changes with every save
+type recordToken struct {
+	column string
+	value  any
+	field  reflect.Value
+}
+
+func concurrencyToken(record any) recordToken {
+	v := reflect.Indirect(reflect.ValueOf(record))
+	if f := v.FieldByName("Version"); f.IsValid() && f.CanInt() {
+		return recordToken{column: "version", value: f.Int(), field: f}
+	}
+	if f := v.FieldByName("UpdatedAt"); f.IsValid() {
+		if updatedAt, ok := f.Interface().(time.Time); ok {
+			return recordToken{column: "updated_at", value: updatedAt, field: f}
+		}
+	}
+	return recordToken{}
+}
+
+func (t recordToken) condition() clause.Eq {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: t.column}, Value: t.value}
+}
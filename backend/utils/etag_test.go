@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"platform/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type versionedTestRecord struct {
+	ID      uuid.UUID
+	Name    string
+	Version int
+}
+
+func TestRecordETagSurvivesStorage(t *testing.T) {
+	// The driver truncates times to the microseconds Postgres keeps
+	saved := models.Setting{UpdatedAt: time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC)}
+	stored := models.Setting{UpdatedAt: time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC).Local()}
+	if RecordETag(&saved) != RecordETag(&stored) {
+		t.Errorf("the tag of the saved record %s differs from the tag of the stored one %s", RecordETag(&saved), RecordETag(&stored))
+	}
+
+	next := models.Setting{UpdatedAt: stored.UpdatedAt.Add(time.Microsecond)}
+	if RecordETag(&next) == RecordETag(&stored) {
+		t.Error("records saved a microsecond apart share a tag")
+	}
+
+	if got := RecordETag(&versionedTestRecord{Version: 7}); got != `"v7"` {
+		t.Errorf("got %s for version 7", got)
+	}
+	if got := RecordETag(&struct{ Name string }{}); got != "" {
+		t.Errorf("got %s for a record without version or update time", got)
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	record := &versionedTestRecord{Version: 3}
+
+	tests := []struct {
+		name, ifMatch string
+		status        int
+	}{
+		{"no header", "", 0},
+		{"any", "*", 0},
+		{"current", `"v3"`, 0},
+		{"in a list", `"v1", "v3"`, 0},
+		{"outdated", `"v2"`, http.StatusPreconditionFailed},
+		{"weak", `W/"v3"`, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPut, "/", nil)
+			if tt.ifMatch != "" {
+				c.Request.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			passed := false
+			H(c, func() {
+				CheckIfMatch(c, record)
+				passed = true
+			})
+			if tt.status == 0 && !passed {
+				t.Fatalf("got %d %s", w.Code, w.Body.String())
+			}
+			if tt.status != 0 && (passed || w.Code != tt.status) {
+				t.Fatalf("got passed=%v status %d, want %d", passed, w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestSaveIfUnchanged(t *testing.T) {
+	d, recorder := recordingDB(t)
+	record := &models.FeatureFlag{Key: "beta", Type: "boolean"}
+	record.ID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	record.UpdatedAt = time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC)
+
+	// A dry run affects no rows, as when another save changed the record
+	if err := SaveIfUnchanged(d, record); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("got error %v, want %v", err, ErrPreconditionFailed)
+	}
+	if len(recorder.statements) != 1 {
+		t.Fatalf("got statements %q", recorder.statements)
+	}
+	// The logged statement shows milliseconds only
+	update := recorder.statements[0]
+	if !strings.HasPrefix(update, `UPDATE "feature_flags"`) ||
+		!strings.Contains(update, `WHERE "feature_flags"."updated_at" = '2026-01-02 03:04:05.123'`) {
+		t.Errorf("the save is not conditional on the read update time: %s", update)
+	}
+}
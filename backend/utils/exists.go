@@ -5,17 +5,23 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 func ExistsBy[T any](field string, value any) bool {
+	return ExistsByIn[T](db.DB, field, value)
+}
+
+// ExistsByIn is ExistsBy in the transaction tx
+func ExistsByIn[T any](tx *gorm.DB, field string, value any) bool {
 	var model T
-	result := db.DB.Where(field+" = ?", value).First(&model)
+	result := tx.Where(columnEq(field, value)).First(&model)
 	return result.RowsAffected > 0
 }
 
 func ExistsExcept[T any](field string, value any, exceptID uuid.UUID) bool {
 	var model T
-	result := db.DB.Where(field+" = ? AND id != ?", value, exceptID).First(&model)
+	result := db.DB.Where(columnEq(field, value)).Where("id != ?", exceptID).First(&model)
 	return result.RowsAffected > 0
 }
 
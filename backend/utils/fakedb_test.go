@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"platform/backend/db"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeSQL is a database/sql driver that records the statements run through
+// it and answers queries with the rows of its handler, to run code that
+// needs a database without one. Every statement affects one row.
+type fakeSQL struct {
+	mu         sync.Mutex
+	statements []fakeStatement
+	rows       func(query string, args []driver.Value) []map[string]driver.Value
+}
+
+type fakeStatement struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeDB replaces db.DB for the test with a database answering queries with
+// rows, which may be nil
+func fakeDB(t *testing.T, rows func(query string, args []driver.Value) []map[string]driver.Value) *fakeSQL {
+	t.Helper()
+	f := &fakeSQL{rows: rows}
+	d, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(f)}), &gorm.Config{
+		Logger:               logger.Discard,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db.DB
+	db.DB = d
+	t.Cleanup(func() { db.DB = previous })
+	return f
+}
+
+// find returns the recorded statements that start with prefix
+func (f *fakeSQL) find(prefix string) []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []fakeStatement
+	for _, s := range f.statements {
+		if strings.HasPrefix(s.query, prefix) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+func (f *fakeSQL) record(query string, args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statements = append(f.statements, fakeStatement{query: query, args: values})
+	return values
+}
+
+func (f *fakeSQL) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeSQL) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ f *fakeSQL }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakeSQL does not prepare statements")
+}
+func (c fakeConn) Close() error { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) {
+	c.f.record("BEGIN", nil)
+	return fakeTx{c.f}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.f.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	values := c.f.record(query, args)
+	var rows []map[string]driver.Value
+	if c.f.rows != nil {
+		rows = c.f.rows(query, values)
+	}
+	return newFakeRows(rows), nil
+}
+
+type fakeTx struct{ f *fakeSQL }
+
+func (tx fakeTx) Commit() error   { tx.f.record("COMMIT", nil); return nil }
+func (tx fakeTx) Rollback() error { tx.f.record("ROLLBACK", nil); return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    []map[string]driver.Value
+}
+
+func newFakeRows(rows []map[string]driver.Value) *fakeRows {
+	r := &fakeRows{rows: rows}
+	if len(rows) > 0 {
+		for column := range rows[0] {
+			r.columns = append(r.columns, column)
+		}
+		sort.Strings(r.columns)
+	}
+	return r
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	for i, column := range r.columns {
+		dest[i] = r.rows[0][column]
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -1,10 +1,25 @@
 package utils
 
 import (
+	"errors"
+
+	"platform/backend/db"
+
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func FetchByParam[T any](c *gin.Context, paramName string) T {
+// FetchByParam loads the record whose ID is in the named parameter,
+// responding 404 when no record matches the ID and scopes
+func FetchByParam[T any](c *gin.Context, paramName string, scopes ...func(*gorm.DB) *gorm.DB) T {
 	id := Get(ParseUUID(c, paramName, "resource"))
-	return Try(ByID[T](id))
+
+	var model T
+	err := db.DB.Scopes(scopes...).Where("id = ?", id).First(&model).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		NotFoundResponse(c, "")
+		Abort()
+	}
+	TryErr(err)
+	return model
 }
@@ -30,6 +30,9 @@ func ExtractFieldValues(req interface{}) map[string]interface{} {
 	return result
 }
 
+// ApplyFieldValues sets the fields of target, a pointer to a struct, to the
+// values of the same name. A nil value clears the field, while a nil pointer
+// is a value the request left out and keeps the field as it is.
 func ApplyFieldValues(target interface{}, values map[string]interface{}) {
 	v := reflect.ValueOf(target).Elem()
 	t := v.Type()
@@ -38,18 +41,46 @@ func ApplyFieldValues(target interface{}, values map[string]interface{}) {
 		field := v.Field(i)
 		fieldType := t.Field(i)
 		
-		if value, ok := values[fieldType.Name]; ok {
-			if !field.CanSet() {
-				continue
-			}
-			
-			valueStr, isString := value.(string)
-			if isString && valueStr != "" {
-				if field.Kind() == reflect.String {
-					field.SetString(valueStr)
-				}
-			}
+		if value, ok := values[fieldType.Name]; ok && field.CanSet() {
+			setFieldValue(field, value)
+		}
+	}
+}
+
+func setFieldValue(field reflect.Value, value interface{}) {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return
+	}
+	
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return
 		}
+		rv = rv.Elem()
+	}
+	
+	target := field.Type()
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	var converted reflect.Value
+	switch {
+	case rv.Type().AssignableTo(target):
+		converted = rv
+	case rv.Kind() == target.Kind() && rv.Type().ConvertibleTo(target):
+		converted = rv.Convert(target)
+	default:
+		return
+	}
+	
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(target)
+		ptr.Elem().Set(converted)
+		field.Set(ptr)
+	} else {
+		field.Set(converted)
 	}
 }
 
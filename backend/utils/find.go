@@ -4,6 +4,8 @@ import (
 	"platform/backend/db"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func ByID[T any](id uuid.UUID) (T, error) {
@@ -26,7 +28,7 @@ func BySlug[T any](slug string) (T, error) {
 
 func Where[T any](field string, value any) (T, error) {
 	var model T
-	err := db.DB.Where(field+" = ?", value).First(&model).Error
+	err := db.DB.Where(columnEq(field, value)).First(&model).Error
 	return model, err
 }
 
@@ -34,14 +36,20 @@ func WhereMultipleList[T any](conditions map[string]any) ([]T, error) {
 	var models []T
 	query := db.DB
 	for field, value := range conditions {
-		query = query.Where(field+" = ?", value)
+		query = query.Where(columnEq(field, value))
 	}
 	err := query.Find(&models).Error
 	return models, err
 }
 
-func All[T any]() ([]T, error) {
+func All[T any](scopes ...func(*gorm.DB) *gorm.DB) ([]T, error) {
 	var models []T
-	err := db.DB.Find(&models).Error
+	err := db.DB.Scopes(scopes...).Find(&models).Error
 	return models, err
 }
+
+// columnEq matches a column to a value. The column is quoted as an
+// identifier, so callers cannot inject SQL through a field name.
+func columnEq(column string, value any) clause.Eq {
+	return clause.Eq{Column: clause.Column{Name: column}, Value: value}
+}
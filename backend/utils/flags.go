@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"hash/fnv"
+
+	"platform/backend/config"
+	"platform/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FlagContext holds the attributes targeting rules are evaluated against
+type FlagContext struct {
+	UserID string
+	OrgID  string
+	Role   string
+	Plan   string
+}
+
+// FlagContextFor builds the flag context of the authenticated user
+func FlagContextFor(c *gin.Context) FlagContext {
+	if ctx, ok := c.Get("flagContext"); ok {
+		return ctx.(FlagContext)
+	}
+
+	userID := GetCurrentUserID(c)
+	user := Try(ByID[models.User](userID))
+	sub := Try(CurrentSubscription(userID))
+
+	ctx := FlagContext{
+		UserID: user.ID.String(),
+		Role:   user.Role,
+		Plan:   sub.PlanKey,
+	}
+	if user.OrganizationID != nil {
+		ctx.OrgID = user.OrganizationID.String()
+	}
+
+	c.Set("flagContext", ctx)
+	return ctx
+}
+
+// EvaluateFlag returns the variant of flag served to ctx. Percentage rules
+// take consecutive shares of the buckets in their order, so two 50% rules
+// split users between their variants.
+func EvaluateFlag(flag models.FeatureFlag, ctx FlagContext) string {
+	if !flag.Enabled {
+		return flag.DefaultVariant
+	}
+
+	bucket := flagBucket(flag.Key, ctx.UserID)
+	share := 0
+	for _, rule := range flag.Rules {
+		from := share
+		if rule.Percentage != nil {
+			share += *rule.Percentage
+		}
+		if !matchesFlagRule(rule, ctx, bucket, from) {
+			continue
+		}
+		if rule.Variant == "" && flag.Type == config.FlagTypeBoolean {
+			return config.FlagOn
+		}
+		if rule.Variant != "" {
+			return rule.Variant
+		}
+	}
+	return flag.DefaultVariant
+}
+
+// matchesFlagRule reports whether rule targets ctx. A percentage rule
+// covers the buckets from from on.
+func matchesFlagRule(rule models.FlagRule, ctx FlagContext, bucket, from int) bool {
+	if rule.Attribute != "" {
+		var value string
+		switch rule.Attribute {
+		case "user":
+			value = ctx.UserID
+		case "org":
+			value = ctx.OrgID
+		case "role":
+			value = ctx.Role
+		case "plan":
+			value = ctx.Plan
+		}
+		if value == "" || !contains(rule.Values, value) {
+			return false
+		}
+	}
+
+	if rule.Percentage != nil {
+		return bucket >= from && bucket < from+*rule.Percentage
+	}
+	return true
+}
+
+// flagBucket places a user in one of 100 buckets. The flag key is part of the
+// hash so rollouts of different flags reach different users.
+func flagBucket(key, userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key + ":" + userID))
+	return int(h.Sum32() % 100)
+}
+
+// flagValue returns true or false for boolean flags and the variant name for
+// multivariate flags
+func flagValue(flag models.FeatureFlag, variant string) any {
+	if flag.Type == config.FlagTypeBoolean {
+		return variant == config.FlagOn
+	}
+	return variant
+}
+
+// FlagVariant evaluates a flag for the current user. Unknown flags return "".
+func FlagVariant(c *gin.Context, key string) string {
+	flag, err := Where[models.FeatureFlag]("key", key)
+	if err != nil {
+		return ""
+	}
+	return EvaluateFlag(flag, FlagContextFor(c))
+}
+
+// FlagEnabled reports whether a boolean flag is on for the current user
+func FlagEnabled(c *gin.Context, key string) bool {
+	return FlagVariant(c, key) == config.FlagOn
+}
+
+// EvaluateFlags evaluates every flag for the current user
+func EvaluateFlags(c *gin.Context) (map[string]any, error) {
+	flags, err := All[models.FeatureFlag]()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := FlagContextFor(c)
+	result := make(map[string]any, len(flags))
+	for _, flag := range flags {
+		result[flag.Key] = flagValue(flag, EvaluateFlag(flag, ctx))
+	}
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"platform/backend/config"
+	"platform/backend/models"
+)
+
+func percentage(p int) *int {
+	return &p
+}
+
+// serveShares evaluates flag for n users and returns the share of users
+// served each variant, in percent
+func serveShares(flag models.FeatureFlag, n int, ctx FlagContext) map[string]float64 {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		ctx.UserID = fmt.Sprintf("user-%d", i)
+		counts[EvaluateFlag(flag, ctx)]++
+	}
+	shares := make(map[string]float64, len(counts))
+	for variant, count := range counts {
+		shares[variant] = float64(count) * 100 / float64(n)
+	}
+	return shares
+}
+
+func TestFlagBucket(t *testing.T) {
+	if flagBucket("checkout", "user-1") != flagBucket("checkout", "user-1") {
+		t.Error("a user moved between buckets")
+	}
+
+	counts := make([]int, 100)
+	for i := 0; i < 100000; i++ {
+		bucket := flagBucket("checkout", fmt.Sprintf("user-%d", i))
+		if bucket < 0 || bucket >= 100 {
+			t.Fatalf("bucket %d is out of range", bucket)
+		}
+		counts[bucket]++
+	}
+	for bucket, count := range counts {
+		if count < 800 || count > 1200 {
+			t.Errorf("bucket %d holds %d of 100000 users", bucket, count)
+		}
+	}
+}
+
+func TestEvaluateFlagSplitsPercentages(t *testing.T) {
+	tests := []struct {
+		name string
+		flag models.FeatureFlag
+		ctx  FlagContext
+		want map[string]float64
+	}{
+		{
+			name: "multivariate 50/50",
+			flag: models.FeatureFlag{Key: "layout", Type: config.FlagTypeMultivariate, Enabled: true,
+				Variants: []string{"a", "b", "c"}, DefaultVariant: "c",
+				Rules: []models.FlagRule{
+					{Percentage: percentage(50), Variant: "a"},
+					{Percentage: percentage(50), Variant: "b"},
+				}},
+			want: map[string]float64{"a": 50, "b": 50},
+		},
+		{
+			name: "multivariate 20/30 and default",
+			flag: models.FeatureFlag{Key: "layout", Type: config.FlagTypeMultivariate, Enabled: true,
+				Variants: []string{"a", "b", "c"}, DefaultVariant: "c",
+				Rules: []models.FlagRule{
+					{Percentage: percentage(20), Variant: "a"},
+					{Percentage: percentage(30), Variant: "b"},
+				}},
+			want: map[string]float64{"a": 20, "b": 30, "c": 50},
+		},
+		{
+			name: "boolean rollout",
+			flag: models.FeatureFlag{Key: "beta", Type: config.FlagTypeBoolean, Enabled: true,
+				DefaultVariant: config.FlagOff,
+				Rules:          []models.FlagRule{{Percentage: percentage(25)}}},
+			want: map[string]float64{config.FlagOn: 25, config.FlagOff: 75},
+		},
+		{
+			name: "targeted rule first",
+			flag: models.FeatureFlag{Key: "beta", Type: config.FlagTypeBoolean, Enabled: true,
+				DefaultVariant: config.FlagOff,
+				Rules: []models.FlagRule{
+					{Attribute: "plan", Values: []string{"pro"}},
+					{Percentage: percentage(10)},
+				}},
+			ctx:  FlagContext{Plan: "pro"},
+			want: map[string]float64{config.FlagOn: 100},
+		},
+		{
+			name: "disabled",
+			flag: models.FeatureFlag{Key: "beta", Type: config.FlagTypeBoolean, DefaultVariant: config.FlagOff,
+				Rules: []models.FlagRule{{Percentage: percentage(100)}}},
+			want: map[string]float64{config.FlagOff: 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares := serveShares(tt.flag, 20000, tt.ctx)
+			if len(shares) != len(tt.want) {
+				t.Fatalf("served %v, want %v", shares, tt.want)
+			}
+			for variant, want := range tt.want {
+				if got := shares[variant]; got < want-2 || got > want+2 {
+					t.Errorf("served %s to %.1f%% of users, want %.0f%%", variant, got, want)
+				}
+			}
+		})
+	}
+}
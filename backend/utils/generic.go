@@ -59,20 +59,35 @@ func MustNotExist[T any](c *gin.Context, msg, where string, args ...interface{})
 	}
 	if exists {
 		Respond(c, StatusConflict, msg, nil)
-		return fmt.Errorf(msg)
+		return errors.New(msg)
 	}
 	return nil
 }
 
+// IsUniqueViolation reports whether err, returned by a statement of tx,
+// violates a unique index
+func IsUniqueViolation(tx *gorm.DB, err error) bool {
+	if translator, ok := tx.Dialector.(gorm.ErrorTranslator); ok {
+		err = translator.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
 func HandleCRUD(c *gin.Context, action string, model interface{}, resourceName string) error {
+	// The request context names the author of versioned records
+	tx := db.DB
+	if c != nil {
+		tx = tx.WithContext(c)
+	}
+
 	var err error
 	switch action {
 	case "create":
-		err = db.DB.Create(model).Error
+		err = tx.Create(model).Error
 	case "update":
-		err = db.DB.Save(model).Error
+		err = tx.Save(model).Error
 	case "delete":
-		err = db.DB.Delete(model).Error
+		err = tx.Delete(model).Error
 	default:
 		return fmt.Errorf("unknown action: %s", action)
 	}
@@ -104,7 +119,12 @@ func BindAndValidate[T any](c *gin.Context) (*T, bool) {
 
 func Execute(c *gin.Context, fn func() error, msg string) error {
 	if err := fn(); err != nil {
-		RespondWithError(c, StatusError, err, msg)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			Respond(c, httpErr.Status, httpErr.Message, nil)
+		} else {
+			RespondWithError(c, StatusError, err, msg)
+		}
 		return err
 	}
 	return nil
@@ -112,20 +132,32 @@ func Execute(c *gin.Context, fn func() error, msg string) error {
 
 func Transaction(c *gin.Context, fn func(tx *gorm.DB) error) error {
 	return Execute(c, func() error {
-		tx := db.DB.Begin()
-		if tx.Error != nil {
-			return tx.Error
-		}
-		
-		if err := fn(tx); err != nil {
-			tx.Rollback()
-			return err
-		}
-		
-		return tx.Commit().Error
+		return RunTransaction(c, fn)
 	}, "Transaction failed")
 }
 
+// RunTransaction runs fn in a transaction like Transaction, but leaves
+// answering a failure to the caller. Functions deferred with AfterCommit run
+// once it commits.
+func RunTransaction(c *gin.Context, fn func(tx *gorm.DB) error) error {
+	ctx, committed := withCommitHooks(c)
+	tx := db.DB.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	committed()
+	return nil
+}
+
 func ApplyUpdates[T any](target *T, updates map[string]interface{}) {
 	for field, value := range updates {
 		if value != nil && value != "" {
@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"platform/backend/config"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// conditionalKey marks the requests of routes that answer conditional GETs
+const conditionalKey = "conditional"
+
+var (
+	responseCacheMu sync.Mutex
+	responseCache   = make(map[string]responseCacheEntry)
+	// responseCacheGenerations counts the invalidations of each table
+	responseCacheGenerations = make(map[string]uint64)
+)
+
+type responseCacheEntry struct {
+	tables       []string
+	body         []byte
+	lastModified string
+	expires      time.Time
+}
+
+// EnableConditional makes Respond answer a successful GET request of the
+// route conditionally, with an ETag hashed from the body unless the handler
+// set one
+func EnableConditional(c *gin.Context) {
+	c.Set(conditionalKey, true)
+}
+
+// isConditional reports whether Respond answers the request conditionally:
+// a GET request of a route that enabled it or whose handler set an ETag
+func isConditional(c *gin.Context) bool {
+	if c.Request == nil || c.Request.Method != http.MethodGet {
+		return false
+	}
+	return c.GetBool(conditionalKey) || c.Writer.Header().Get("ETag") != ""
+}
+
+// WriteConditional writes body, a JSON response to a GET request, or 304 Not
+// Modified when the client's copy named by If-None-Match or If-Modified-Since
+// is current. Responses without an ETag get a weak one hashed from the body.
+func WriteConditional(c *gin.Context, status HTTPStatus, body []byte) {
+	etag := c.Writer.Header().Get("ETag")
+	if etag == "" {
+		sum := sha256.Sum256(body)
+		etag = `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+		c.Header("ETag", etag)
+	}
+
+	if status == StatusOK && notModified(c.Request, etag, c.Writer.Header().Get("Last-Modified")) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(int(status), "application/json; charset=utf-8", body)
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since without it, as
+// RFC 9110 describes for GET requests
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified == "" {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	return err == nil && !modified.After(since)
+}
+
+// SetLastModified sets the Last-Modified header, which HTTP dates give to
+// the second
+func SetLastModified(c *gin.Context, modified time.Time) {
+	if !modified.IsZero() {
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// CachedResponse returns the cached body of the response stored under key
+// and its Last-Modified header
+func CachedResponse(key string) ([]byte, string, bool) {
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+	entry, ok := responseCache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, "", false
+	}
+	return entry.body, entry.lastModified, true
+}
+
+// ResponseGeneration returns a number that changes whenever cached responses
+// read from one of tables are invalidated. Take it before reading the tables
+// and pass it to CacheResponse.
+func ResponseGeneration(tables []string) uint64 {
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+	var generation uint64
+	for _, table := range tables {
+		generation += responseCacheGenerations[table]
+	}
+	return generation
+}
+
+// CacheResponse stores a response body under key for
+// config.GetResponseCacheTTL, or until a table it was read from changes. A
+// body read before generation changed may be out of date and is not stored.
+func CacheResponse(key string, tables []string, body []byte, lastModified string, generation uint64) {
+	ttl := config.GetResponseCacheTTL()
+	if ttl == 0 {
+		return
+	}
+
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+	var current uint64
+	for _, table := range tables {
+		current += responseCacheGenerations[table]
+	}
+	if current != generation {
+		return
+	}
+
+	for key, entry := range responseCache {
+		if time.Now().After(entry.expires) {
+			delete(responseCache, key)
+		}
+	}
+	responseCache[key] = responseCacheEntry{
+		tables:       tables,
+		body:         body,
+		lastModified: lastModified,
+		expires:      time.Now().Add(ttl),
+	}
+}
+
+// InvalidateResponses drops the cached responses read from table
+func InvalidateResponses(table string) {
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+	responseCacheGenerations[table]++
+	for key, entry := range responseCache {
+		for _, t := range entry.tables {
+			if t == table {
+				delete(responseCache, key)
+				break
+			}
+		}
+	}
+}
+
+// RegisterResponseCacheInvalidation adds the callbacks that drop cached
+// responses when a record of a table they were read from is created,
+// updated or deleted through d, once the change commits, see AfterCommit.
+// Outside of a transaction they run after gorm commits the statement.
+func RegisterResponseCacheInvalidation(d *gorm.DB) error {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.DryRun || tx.Statement.Table == "" {
+			return
+		}
+		table := tx.Statement.Table
+		AfterCommit(tx, func() {
+			InvalidateResponses(table)
+		})
+	}
+
+	// The default transaction of a statement commits in
+	// gorm:commit_or_rollback_transaction
+	const after = "gorm:commit_or_rollback_transaction"
+	if err := d.Callback().Create().After(after).Register("cache:create", invalidate); err != nil {
+		return err
+	}
+	if err := d.Callback().Update().After(after).Register("cache:update", invalidate); err != nil {
+		return err
+	}
+	return d.Callback().Delete().After(after).Register("cache:delete", invalidate)
+}
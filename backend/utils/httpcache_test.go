@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCacheResponseSkipsInvalidatedReads(t *testing.T) {
+	t.Setenv("RESPONSE_CACHE_TTL", "1m")
+	tables := []string{"cache_test_settings"}
+
+	generation := ResponseGeneration(tables)
+	InvalidateResponses(tables[0])
+	CacheResponse("/stale", tables, []byte(`{}`), "", generation)
+	if _, _, ok := CachedResponse("/stale"); ok {
+		t.Error("a response read before an invalidation was cached")
+	}
+
+	CacheResponse("/fresh", tables, []byte(`{}`), "", ResponseGeneration(tables))
+	if _, _, ok := CachedResponse("/fresh"); !ok {
+		t.Fatal("the response was not cached")
+	}
+	InvalidateResponses(tables[0])
+	if _, _, ok := CachedResponse("/fresh"); ok {
+		t.Error("the response outlived its invalidation")
+	}
+}
+
+func TestRespondConditional(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	respond := func(enable bool, ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		if ifNoneMatch != "" {
+			c.Request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		if enable {
+			EnableConditional(c)
+		}
+		Respond(c, StatusOK, "ok", gin.H{"n": 1})
+		c.Writer.WriteHeaderNow()
+		return w
+	}
+
+	if w := respond(false, ""); w.Header().Get("ETag") != "" {
+		t.Errorf("a route that did not opt in got ETag %s", w.Header().Get("ETag"))
+	}
+
+	w := respond(true, "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("got %d with ETag %q", w.Code, etag)
+	}
+	if w := respond(true, etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("a current copy got %d %s", w.Code, w.Body.String())
+	}
+	if w := respond(true, `W/"other"`); w.Code != http.StatusOK {
+		t.Errorf("an outdated copy got %d", w.Code)
+	}
+}
@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/db"
+	"platform/backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvoiceVoid = errors.New("invoice is already void")
+	ErrInvoicePaid = errors.New("paid invoices cannot be voided")
+)
+
+// NextInvoiceNumber allocates the next sequential number of a seller. The
+// sequence row stays locked until tx commits, so numbers have no gaps.
+func NextInvoiceNumber(tx *gorm.DB, seller string) (string, error) {
+	var next int64
+	err := tx.Raw(`INSERT INTO invoice_sequences (seller, next) VALUES (?, 1)
+		ON CONFLICT (seller) DO UPDATE SET next = invoice_sequences.next + 1
+		RETURNING next`, seller).Scan(&next).Error
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%06d", config.GetInvoicePrefix(), next), nil
+}
+
+// BuildInvoiceLines prices a closed billing period of a subscription
+func BuildInvoiceLines(tx *gorm.DB, sub models.Subscription) ([]models.InvoiceLine, error) {
+	plan := config.GetPlan(sub.PlanKey)
+
+	var lines []models.InvoiceLine
+	if plan.Price > 0 {
+		lines = append(lines, models.InvoiceLine{
+			Description: plan.Name + " plan",
+			Quantity:    1,
+			UnitAmount:  plan.Price,
+			Amount:      plan.Price,
+		})
+	}
+
+	var records []models.UsageRecord
+	err := tx.Where("user_id = ? AND period_start = ?", sub.UserID, sub.CurrentPeriodStart).
+		Order("metric").
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		unitPrice := plan.UnitPrices[record.Metric]
+		if unitPrice == 0 || record.Quantity == 0 {
+			continue
+		}
+		lines = append(lines, models.InvoiceLine{
+			Description: "Usage: " + record.Metric,
+			Quantity:    record.Quantity,
+			UnitAmount:  unitPrice,
+			Amount:      unitPrice * record.Quantity,
+		})
+	}
+
+	return lines, nil
+}
+
+// IssueInvoice numbers, totals and stores an invoice with the given lines
+func IssueInvoice(tx *gorm.DB, invoice *models.Invoice, lines []models.InvoiceLine) error {
+	number, err := NextInvoiceNumber(tx, config.GetInvoiceSeller())
+	if err != nil {
+		return err
+	}
+
+	invoice.Seller = config.GetInvoiceSeller()
+	invoice.Number = number
+	invoice.Status = config.InvoiceStatusOpen
+	invoice.Currency = config.GetCurrency()
+	invoice.TaxRate = config.GetTaxRate()
+	invoice.IssuedAt = time.Now().UTC()
+	invoice.Lines = lines
+
+	invoice.Subtotal = 0
+	for i := range invoice.Lines {
+		invoice.Lines[i].BaseModel = models.BaseModel{}
+		invoice.Lines[i].InvoiceID = uuid.Nil
+		invoice.Subtotal += invoice.Lines[i].Amount
+	}
+	invoice.Tax = int64(math.Round(float64(invoice.Subtotal) * invoice.TaxRate / 100))
+	invoice.Total = invoice.Subtotal + invoice.Tax
+
+	return tx.Create(invoice).Error
+}
+
+// CloseBillingPeriods invoices every subscription whose period has ended and
+// starts its next period
+func CloseBillingPeriods(now time.Time) error {
+	var due []models.Subscription
+	if err := db.DB.Where("current_period_end <= ?", now).Find(&due).Error; err != nil {
+		return err
+	}
+
+	for _, sub := range due {
+		if err := closeBillingPeriod(sub.ID, now); err != nil {
+			log.Printf("Failed to close billing period of subscription %s: %v", sub.ID, err)
+		}
+	}
+	return nil
+}
+
+func closeBillingPeriod(id uuid.UUID, now time.Time) error {
+	var invoiceID uuid.UUID
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var sub models.Subscription
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ? AND current_period_end <= ?", id, now).
+			First(&sub).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Trial periods are free and suspended or cancelled subscriptions are
+		// not billed, their periods only roll forward
+		if sub.Status == config.StatusActive || sub.Status == config.StatusPastDue {
+			var err error
+			if invoiceID, err = invoiceBillingPeriod(tx, &sub); err != nil {
+				return err
+			}
+		}
+
+		wasTrial := sub.Status == config.StatusTrialing
+		sub.CurrentPeriodStart = sub.CurrentPeriodEnd
+		sub.CurrentPeriodEnd = sub.CurrentPeriodEnd.AddDate(0, 1, 0)
+
+		if wasTrial {
+			return endTrial(tx, &sub)
+		}
+		return tx.Save(&sub).Error
+	})
+	if err != nil || invoiceID == uuid.Nil {
+		return err
+	}
+	// The invoice is committed before it is charged
+	return ChargeInvoice(invoiceID)
+}
+
+// invoiceBillingPeriod issues the invoice of the subscription's current
+// period and returns its ID, or uuid.Nil when there is nothing to charge
+func invoiceBillingPeriod(tx *gorm.DB, sub *models.Subscription) (uuid.UUID, error) {
+	lines, err := BuildInvoiceLines(tx, *sub)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if lines, err = ApplyDiscount(tx, *sub, lines); err != nil {
+		return uuid.Nil, err
+	}
+
+	// Periods with nothing to charge don't produce an invoice
+	if len(lines) == 0 {
+		return uuid.Nil, nil
+	}
+
+	invoice := models.Invoice{
+		UserID:         sub.UserID,
+		SubscriptionID: sub.ID,
+		PeriodStart:    sub.CurrentPeriodStart,
+		PeriodEnd:      sub.CurrentPeriodEnd,
+	}
+	if err := IssueInvoice(tx, &invoice, lines); err != nil {
+		return uuid.Nil, err
+	}
+	log.Printf("Issued invoice %s for subscription %s", invoice.Number, sub.ID)
+	return invoice.ID, nil
+}
+
+func VoidInvoice(tx *gorm.DB, invoice *models.Invoice) error {
+	if invoice.Status == config.InvoiceStatusVoid {
+		return ErrInvoiceVoid
+	}
+	if invoice.Status == config.InvoiceStatusPaid {
+		return ErrInvoicePaid
+	}
+
+	now := time.Now().UTC()
+	invoice.Status = config.InvoiceStatusVoid
+	invoice.VoidedAt = &now
+	return tx.Omit(clause.Associations).Save(invoice).Error
+}
+
+// ReissueInvoice voids an invoice and issues a replacement with the same
+// lines under a new number
+func ReissueInvoice(tx *gorm.DB, invoice *models.Invoice) (*models.Invoice, error) {
+	if err := tx.Model(invoice).Association("Lines").Find(&invoice.Lines); err != nil {
+		return nil, err
+	}
+
+	if invoice.Status != config.InvoiceStatusVoid {
+		if err := VoidInvoice(tx, invoice); err != nil {
+			return nil, err
+		}
+	}
+
+	replacement := &models.Invoice{
+		UserID:         invoice.UserID,
+		SubscriptionID: invoice.SubscriptionID,
+		PeriodStart:    invoice.PeriodStart,
+		PeriodEnd:      invoice.PeriodEnd,
+		ReplacesID:     &invoice.ID,
+	}
+	lines := append([]models.InvoiceLine(nil), invoice.Lines...)
+	return replacement, IssueInvoice(tx, replacement, lines)
+}
+
+// FormatMoney formats an amount in minor units, e.g. "USD 29.00"
+func FormatMoney(amount int64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s %s%d.%02d", currency, sign, amount/100, amount%100)
+}
+
+// RenderInvoicePDF renders an invoice with its lines loaded
+func RenderInvoicePDF(invoice models.Invoice, customer models.User) []byte {
+	pdf := NewPDF()
+	const left, right = 50.0, PDFPageWidth - 50
+
+	pdf.Text(left, 70, 22, true, "INVOICE")
+	pdf.TextRight(right, 70, 12, true, invoice.Number)
+	if invoice.Status == config.InvoiceStatusVoid {
+		pdf.TextRight(right, 88, 12, true, "VOID")
+	}
+
+	pdf.Text(left, 110, 11, true, invoice.Seller)
+	if address := config.GetInvoiceSellerAddress(); address != "" {
+		pdf.Text(left, 125, 10, false, address)
+	}
+
+	pdf.Text(left, 160, 10, true, "Bill to")
+	pdf.Text(left, 175, 10, false, customer.FirstName+" "+customer.LastName)
+	pdf.Text(left, 190, 10, false, customer.Email)
+
+	pdf.Text(330, 160, 10, true, "Issued")
+	pdf.Text(420, 160, 10, false, invoice.IssuedAt.Format("2006-01-02"))
+	pdf.Text(330, 175, 10, true, "Period")
+	pdf.Text(420, 175, 10, false, invoice.PeriodStart.Format("2006-01-02")+" - "+invoice.PeriodEnd.Format("2006-01-02"))
+	pdf.Text(330, 190, 10, true, "Status")
+	pdf.Text(420, 190, 10, false, invoice.Status)
+
+	header := func(y float64) {
+		pdf.Text(left, y, 10, true, "Description")
+		pdf.TextRight(360, y, 10, true, "Qty")
+		pdf.TextRight(450, y, 10, true, "Unit price")
+		pdf.TextRight(right, y, 10, true, "Amount")
+		pdf.Line(left, y+6, right, y+6)
+	}
+
+	y := 240.0
+	header(y)
+	for _, line := range invoice.Lines {
+		y += 20
+		if y > PDFPageHeight-120 {
+			pdf.AddPage()
+			y = 70
+			header(y)
+			y += 20
+		}
+		pdf.Text(left, y, 10, false, line.Description)
+		pdf.TextRight(360, y, 10, false, fmt.Sprint(line.Quantity))
+		pdf.TextRight(450, y, 10, false, FormatMoney(line.UnitAmount, invoice.Currency))
+		pdf.TextRight(right, y, 10, false, FormatMoney(line.Amount, invoice.Currency))
+	}
+
+	y += 14
+	pdf.Line(330, y, right, y)
+	totals := []struct {
+		label  string
+		amount int64
+	}{
+		{"Subtotal", invoice.Subtotal},
+		{fmt.Sprintf("Tax (%.2f%%)", invoice.TaxRate), invoice.Tax},
+		{"Total", invoice.Total},
+	}
+	for _, total := range totals {
+		y += 18
+		bold := total.label == "Total"
+		pdf.Text(330, y, 10, bold, total.label)
+		pdf.TextRight(right, y, 10, bold, FormatMoney(total.amount, invoice.Currency))
+	}
+
+	return pdf.Bytes()
+}
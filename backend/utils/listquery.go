@@ -0,0 +1,449 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"platform/backend/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	DefaultPageSize = 25
+	MaxPageSize     = 100
+
+	// Values of the trashed parameter: only soft-deleted records, or soft
+	// deleted records as well as live ones
+	TrashedOnly = "only"
+	TrashedWith = "with"
+)
+
+// ListQuery is a validated page, sort and filter request for a list endpoint
+type ListQuery struct {
+	Page     int
+	PageSize int
+	Sort     []ListSort
+	Filters  []ListFilter
+	Search   string
+	Trashed  string
+	// Fields are the JSON names of the only fields returned, and Include
+	// names the associations to return with each record; the list endpoint
+	// checks which associations exist
+	Fields  []string
+	Include []string
+	// Keyset pages by Cursor instead of by page number; Cursor is nil on
+	// the first page
+	Keyset bool
+	Cursor *Cursor
+	// scope identifies the list and its filters in the cursors it issues
+	scope string
+}
+
+type ListSort struct {
+	Column string
+	Desc   bool
+}
+
+type ListFilter struct {
+	Column string
+	Op     string
+	Value  string
+}
+
+type Pagination struct {
+	Page       int   `json:"page"`
+	PageSize   int   `json:"pageSize"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"totalPages"`
+}
+
+var filterOperators = map[string]string{
+	"eq":   "=",
+	"ne":   "<>",
+	"gt":   ">",
+	"gte":  ">=",
+	"lt":   "<",
+	"lte":  "<=",
+	"in":   "IN",
+	"like": "ILIKE",
+}
+
+var filterParam = regexp.MustCompile(`^filter\[(\w+)\](?:\[(\w+)\])?$`)
+
+// ParseListQuery reads the list parameters shared by every list endpoint:
+//
+//	page=2&pageSize=50
+//	sort=-createdAt,key          descending with a leading -
+//	filter[key]=value            also filter[key][op]=value with op one of
+//	                             eq, ne, gt, gte, lt, lte, in (comma
+//	                             separated values) and like (contains,
+//	                             case-insensitive)
+//	fields=id,key                return only these fields
+//	include=lines                return these associations too
+//	q=term                       search, see SearchMode
+//	cursor=token                 page by cursor, newest first; empty for
+//	                             the first page. A cursor only pages the
+//	                             path, filters and search it came from.
+//
+// Fields are JSON names and must be keys of columns, the whitelist of model.
+// Filter values must suit the type of the field they filter.
+func ParseListQuery(c *gin.Context, model any, columns map[string]string) (ListQuery, error) {
+	query := ListQuery{Page: 1, PageSize: DefaultPageSize}
+	var modelSchema *schema.Schema
+	if model != nil {
+		modelSchema, _ = schema.Parse(model, &listSchemas, schema.NamingStrategy{})
+	}
+
+	if raw := c.Query("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return query, fmt.Errorf("invalid page %q", raw)
+		}
+		query.Page = page
+	}
+
+	if raw := c.Query("pageSize"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 || size > MaxPageSize {
+			return query, fmt.Errorf("pageSize must be between 1 and %d", MaxPageSize)
+		}
+		query.PageSize = size
+	}
+
+	query.Search = strings.TrimSpace(c.Query("q"))
+
+	query.Trashed = c.Query("trashed")
+	if query.Trashed != "" && query.Trashed != TrashedOnly && query.Trashed != TrashedWith {
+		return query, fmt.Errorf("trashed must be %s or %s", TrashedOnly, TrashedWith)
+	}
+
+	sort := c.Query("sort")
+	if sort == "" {
+		if _, ok := columns["createdAt"]; ok {
+			sort = "-createdAt"
+		}
+	}
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+
+		column, ok := columns[field]
+		if !ok {
+			return query, fmt.Errorf("cannot sort by %q", field)
+		}
+		query.Sort = append(query.Sort, ListSort{Column: column, Desc: desc})
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		match := filterParam.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+
+		field, op := match[1], match[2]
+		if op == "" {
+			op = "eq"
+		}
+
+		column, ok := columns[field]
+		if !ok {
+			return query, fmt.Errorf("cannot filter by %q", field)
+		}
+		if _, ok := filterOperators[op]; !ok {
+			return query, fmt.Errorf("unknown filter operator %q", op)
+		}
+
+		for _, value := range values {
+			filter := ListFilter{Column: column, Op: op, Value: value}
+			if modelSchema != nil {
+				if schemaField := modelSchema.LookUpField(column); schemaField != nil {
+					if err := checkFilter(schemaField.FieldType, field, filter); err != nil {
+						return query, err
+					}
+				}
+			}
+			query.Filters = append(query.Filters, filter)
+		}
+	}
+
+	for _, field := range splitList(c.Query("fields")) {
+		if _, ok := columns[field]; !ok {
+			return query, fmt.Errorf("unknown field %q", field)
+		}
+		query.Fields = append(query.Fields, field)
+	}
+	query.Include = splitList(c.Query("include"))
+
+	if raw, ok := c.GetQuery("cursor"); ok {
+		if c.Query("sort") != "" || c.Query("page") != "" {
+			return query, fmt.Errorf("cursor cannot be combined with sort or page")
+		}
+		query.Keyset = true
+		query.scope = listScope(c.Request.URL.Path, query)
+		if raw != "" {
+			cursor, err := DecodeCursor(raw)
+			if err != nil {
+				return query, err
+			}
+			if cursor.Scope != query.scope {
+				return query, errCursorScope
+			}
+			query.Cursor = &cursor
+		}
+	}
+
+	return query, nil
+}
+
+// listSchemas caches the schemas of the models lists are parsed for
+var listSchemas sync.Map
+
+// checkFilter refuses filters that Postgres could not run against a field of
+// type t named field: like on anything but text, and values that do not
+// convert to the field's type
+func checkFilter(t reflect.Type, field string, f ListFilter) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if f.Op == "like" {
+		if t.Kind() != reflect.String {
+			return fmt.Errorf("like cannot filter %q, which is not text", field)
+		}
+		return nil
+	}
+
+	values := []string{f.Value}
+	if f.Op == "in" {
+		values = splitList(f.Value)
+	}
+	for _, value := range values {
+		var err error
+		switch {
+		case t == uuidType:
+			// Postgres takes the standard form only
+			if _, err = uuid.Parse(value); err == nil && len(value) != 36 {
+				err = fmt.Errorf("not a standard UUID")
+			}
+		case t == timeType || t == deletedAtType:
+			if _, err = time.Parse(time.RFC3339, value); err != nil {
+				_, err = time.Parse(time.DateOnly, value)
+			}
+		default:
+			switch t.Kind() {
+			case reflect.String:
+			case reflect.Bool:
+				_, err = strconv.ParseBool(value)
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				_, err = strconv.ParseInt(value, 10, 64)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				_, err = strconv.ParseUint(value, 10, 64)
+			case reflect.Float32, reflect.Float64:
+				_, err = strconv.ParseFloat(value, 64)
+			default:
+				return fmt.Errorf("cannot filter by %q", field)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value %q to filter %q", value, field)
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated parameter, dropping empty items
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Trash includes soft-deleted records as the trashed parameter asks
+func (q ListQuery) Trash(tx *gorm.DB) *gorm.DB {
+	switch q.Trashed {
+	case TrashedOnly:
+		return tx.Unscoped().Where("deleted_at IS NOT NULL")
+	case TrashedWith:
+		return tx.Unscoped()
+	}
+	return tx
+}
+
+// Filter adds the WHERE conditions of the query
+func (q ListQuery) Filter(tx *gorm.DB) *gorm.DB {
+	for _, f := range q.Filters {
+		var value interface{} = f.Value
+		switch f.Op {
+		case "in":
+			value = splitList(f.Value)
+		case "like":
+			value = "%" + likeEscaper.Replace(f.Value) + "%"
+		}
+		tx = tx.Where(clause.Expr{
+			SQL:  fmt.Sprintf("? %s ?", filterOperators[f.Op]),
+			Vars: []interface{}{clause.Column{Name: f.Column}, value},
+		})
+	}
+	return tx
+}
+
+// Search modes, see SearchMode
+const (
+	SearchSubstring = "substring"
+	SearchWords     = "words"
+)
+
+// SearchMode returns how search terms match: SearchSubstring finds the term
+// anywhere in a search field, case-insensitively, and a trigram index only
+// speeds that up. With a tsvector index, SearchWords finds records holding
+// every word of the term as a whole word, so "jo" no longer finds "John".
+// The admin tells clients the mode along with the resources.
+func SearchMode() string {
+	if config.GetAdminSearchIndex() == "tsvector" {
+		return SearchWords
+	}
+	return SearchSubstring
+}
+
+// SearchIn matches the search term against columns as SearchMode describes
+func (q ListQuery) SearchIn(tx *gorm.DB, columns []string) *gorm.DB {
+	if q.Search == "" || len(columns) == 0 {
+		return tx
+	}
+
+	if SearchMode() == SearchWords {
+		return tx.Where(searchVector(columns)+" @@ plainto_tsquery('simple', ?)", q.Search)
+	}
+
+	pattern := "%" + likeEscaper.Replace(q.Search) + "%"
+	conditions := make([]string, len(columns))
+	vars := make([]interface{}, 0, len(columns)*2)
+	for i, column := range columns {
+		conditions[i] = "? ILIKE ?"
+		vars = append(vars, clause.Column{Name: column}, pattern)
+	}
+	return tx.Where(clause.Expr{SQL: "(" + strings.Join(conditions, " OR ") + ")", Vars: vars})
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// searchVector is the tsvector expression of columns, shared by search
+// queries and the index created for them
+func searchVector(columns []string) string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		parts[i] = fmt.Sprintf(`coalesce(%q::text, '')`, column)
+	}
+	return "to_tsvector('simple', " + strings.Join(parts, " || ' ' || ") + ")"
+}
+
+// Order adds the ORDER BY clause of the query. Records are ordered by id
+// last, so that records with equal sort values keep their place between
+// pages.
+func (q ListQuery) Order(tx *gorm.DB) *gorm.DB {
+	unique := false
+	for _, s := range q.Sort {
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Column}, Desc: s.Desc})
+		unique = unique || s.Column == "id"
+	}
+	if !unique {
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}})
+	}
+	return tx
+}
+
+// Paginate limits the query to the requested page
+func (q ListQuery) Paginate(tx *gorm.DB) *gorm.DB {
+	return tx.Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize)
+}
+
+func (q ListQuery) Pagination(total int64) Pagination {
+	return Pagination{
+		Page:       q.Page,
+		PageSize:   q.PageSize,
+		Total:      total,
+		TotalPages: int((total + int64(q.PageSize) - 1) / int64(q.PageSize)),
+	}
+}
+
+// Project returns items, a slice of records, as JSON objects holding only the
+// query's fields and included associations. Items are returned unchanged
+// when the query names no fields.
+func (q ListQuery) Project(items any) (any, error) {
+	if len(q.Fields) == 0 {
+		return items, nil
+	}
+
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var records []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, err
+	}
+
+	keep := append(append([]string(nil), q.Fields...), q.Include...)
+	projected := make([]map[string]json.RawMessage, len(records))
+	for i, record := range records {
+		projected[i] = make(map[string]json.RawMessage, len(keep))
+		for _, name := range keep {
+			if value, ok := record[name]; ok {
+				projected[i][name] = value
+			}
+		}
+	}
+	return projected, nil
+}
+
+// QueryFields returns the list query whitelists of a model, built from the
+// fields tagged query:"true". columns maps the JSON name of each field that
+// may be filtered, sorted and selected to its column; includes maps the JSON
+// name of each association that may be included to its Go field name.
+func QueryFields(model any) (columns, includes map[string]string) {
+	columns, includes = make(map[string]string), make(map[string]string)
+
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				walk(field.Type)
+				continue
+			}
+			if field.Tag.Get("query") != "true" {
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			if column := columnName(field); column != "" {
+				columns[name] = column
+			} else {
+				includes[name] = field.Name
+			}
+		}
+	}
+	walk(reflect.Indirect(reflect.ValueOf(model)).Type())
+	return columns, includes
+}
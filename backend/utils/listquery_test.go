@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type listTestRecord struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Name      string
+	Count     int
+	Enabled   bool
+	OwnerID   *uuid.UUID
+	Tags      []string `gorm:"serializer:json"`
+}
+
+var listTestColumns = map[string]string{
+	"id":        "id",
+	"createdAt": "created_at",
+	"name":      "name",
+	"count":     "count",
+	"enabled":   "enabled",
+	"ownerId":   "owner_id",
+	"tags":      "tags",
+}
+
+func TestParseListQueryFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"filter[name][like]=ann", ""},
+		{"filter[ownerId]=00000000-0000-0000-0000-000000000001", ""},
+		{"filter[ownerId][in]=00000000-0000-0000-0000-000000000001,00000000-0000-0000-0000-000000000002", ""},
+		{"filter[createdAt][gte]=2026-01-02", ""},
+		{"filter[createdAt][lt]=2026-01-02T03:04:05.123Z", ""},
+		{"filter[count][gt]=3&filter[enabled]=true", ""},
+		{"filter[ownerId]=42", `invalid value "42" to filter "ownerId"`},
+		{"filter[ownerId]=urn:uuid:00000000-0000-0000-0000-000000000001", `invalid value`},
+		{"filter[ownerId][in]=00000000-0000-0000-0000-000000000001,x", `invalid value "x" to filter "ownerId"`},
+		{"filter[count][like]=3", `like cannot filter "count", which is not text`},
+		{"filter[count]=three", `invalid value "three" to filter "count"`},
+		{"filter[enabled]=maybe", `invalid value "maybe" to filter "enabled"`},
+		{"filter[createdAt][gt]=yesterday", `invalid value "yesterday" to filter "createdAt"`},
+		{"filter[tags]=a", `cannot filter by "tags"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+
+			_, err := ParseListQuery(c, &listTestRecord{}, listTestColumns)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("got error %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestListQueryOrder(t *testing.T) {
+	tests := []struct {
+		sort []ListSort
+		want string
+	}{
+		{nil, `ORDER BY "id"`},
+		{[]ListSort{{Column: "created_at", Desc: true}}, `ORDER BY "created_at" DESC,"id"`},
+		{[]ListSort{{Column: "id", Desc: true}, {Column: "name"}}, `ORDER BY "id" DESC,"name"`},
+	}
+
+	for _, tt := range tests {
+		got := dryRunDB(t).ToSQL(func(tx *gorm.DB) *gorm.DB {
+			return ListQuery{Sort: tt.sort}.Order(tx.Model(&listTestRecord{})).Find(&[]listTestRecord{})
+		})
+		if !strings.HasSuffix(got, tt.want) {
+			t.Errorf("got %s, want it to end with %s", got, tt.want)
+		}
+	}
+}
+
+func TestSearchIn(t *testing.T) {
+	tests := []struct {
+		index, mode, want string
+	}{
+		{"", SearchSubstring, `WHERE ("name" ILIKE '%an\_n%' OR "email" ILIKE '%an\_n%')`},
+		{"trigram", SearchSubstring, `WHERE ("name" ILIKE '%an\_n%' OR "email" ILIKE '%an\_n%')`},
+		{"tsvector", SearchWords, `WHERE to_tsvector('simple', coalesce("name"::text, '') || ' ' || coalesce("email"::text, '')) @@ plainto_tsquery('simple', 'an_n')`},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("ADMIN_SEARCH_INDEX", tt.index)
+		if got := SearchMode(); got != tt.mode {
+			t.Errorf("index %q searches %s, want %s", tt.index, got, tt.mode)
+		}
+		got := dryRunDB(t).ToSQL(func(tx *gorm.DB) *gorm.DB {
+			return ListQuery{Search: "an_n"}.SearchIn(tx.Model(&listTestRecord{}), []string{"name", "email"}).Find(&[]listTestRecord{})
+		})
+		if !strings.HasSuffix(got, tt.want) {
+			t.Errorf("index %q: got %s, want it to end with %s", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestCursorScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	parse := func(target string) (ListQuery, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+		return ParseListQuery(c, &listTestRecord{}, listTestColumns)
+	}
+
+	query, err := parse("/a?cursor=&pageSize=1&filter[name]=ann&filter[count][gt]=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []listTestRecord{{ID: uuid.New(), CreatedAt: time.Now()}, {ID: uuid.New(), CreatedAt: time.Now()}}
+	cursor := query.CursorPage(&items).NextCursor
+	if cursor == "" {
+		t.Fatal("no next cursor")
+	}
+
+	tests := []struct {
+		target string
+		ok     bool
+	}{
+		{"/a?filter[name]=ann&filter[count][gt]=3&cursor=", true},
+		{"/a?filter[count][gt]=3&filter[name]=ann&pageSize=5&cursor=", true},
+		{"/b?filter[name]=ann&filter[count][gt]=3&cursor=", false},
+		{"/a?filter[name]=bob&filter[count][gt]=3&cursor=", false},
+		{"/a?filter[name]=ann&cursor=", false},
+		{"/a?filter[name]=ann&filter[count][gt]=3&q=x&cursor=", false},
+		{"/a?filter[name]=ann&filter[count][gt]=3&trashed=with&cursor=", false},
+	}
+	for _, tt := range tests {
+		got, err := parse(tt.target + cursor)
+		if tt.ok && (err != nil || got.Cursor == nil) {
+			t.Errorf("%s: unexpected error %v", tt.target, err)
+		}
+		if !tt.ok && err != errCursorScope {
+			t.Errorf("%s: got %v, want %v", tt.target, err, errCursorScope)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"log"
+
+	"platform/backend/config"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// SendMail sends a plain text email, or logs it when no SMTP server is
+// configured
+func SendMail(to, subject, body string) error {
+	if config.GetSMTPHost() == "" {
+		log.Printf("Mail to %s: %s\n%s", to, subject, body)
+		return nil
+	}
+
+	server := mail.NewSMTPClient()
+	server.Host = config.GetSMTPHost()
+	server.Port = config.GetSMTPPort()
+	server.Username = config.GetSMTPUser()
+	server.Password = config.GetSMTPPassword()
+	server.Encryption = mail.EncryptionSTARTTLS
+
+	client, err := server.Connect()
+	if err != nil {
+		return err
+	}
+
+	email := mail.NewMSG().
+		SetFrom(config.GetMailFrom()).
+		AddTo(to).
+		SetSubject(subject).
+		SetBody(mail.TextPlain, body)
+	if email.Error != nil {
+		return email.Error
+	}
+	return email.Send(client)
+}
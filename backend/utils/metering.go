@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/db"
+	"platform/backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+type QuotaStatus struct {
+	Metric    string  `json:"metric"`
+	Used      int64   `json:"used"`
+	Limit     int64   `json:"limit"`
+	Unlimited bool    `json:"unlimited"`
+	Percent   float64 `json:"percent"`
+	Warning   string  `json:"warning,omitempty"`
+}
+
+// CurrentSubscription returns the user's subscription, starting one the
+// first time usage is metered for users that predate subscriptions
+func CurrentSubscription(userID uuid.UUID) (models.Subscription, error) {
+	sub, err := Where[models.Subscription]("user_id", userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return StartSubscription(db.DB, userID)
+	}
+	return sub, err
+}
+
+// BillingPeriod returns the period containing at. Periods that have ended but
+// were not yet closed are rolled forward month by month.
+func BillingPeriod(sub models.Subscription, at time.Time) (time.Time, time.Time) {
+	start, end := sub.CurrentPeriodStart, sub.CurrentPeriodEnd
+	for !at.Before(end) {
+		start, end = end, end.AddDate(0, 1, 0)
+	}
+	return start, end
+}
+
+// RecordUsage stores a usage event and adds it to the rollup of its period
+func RecordUsage(userID uuid.UUID, metric string, quantity int64) error {
+	sub, err := CurrentSubscription(userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	start, end := BillingPeriod(sub, now)
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		event := models.UsageEvent{UserID: userID, Metric: metric, Quantity: quantity}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		record := models.UsageRecord{
+			UserID:      userID,
+			Metric:      metric,
+			PeriodStart: start,
+			PeriodEnd:   end,
+			Quantity:    quantity,
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "metric"}, {Name: "period_start"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"quantity":   gorm.Expr("usage_records.quantity + excluded.quantity"),
+				"updated_at": now,
+			}),
+		}).Create(&record).Error
+	})
+}
+
+// UsageFor returns the quantity used for a metric in the current period
+func UsageFor(sub models.Subscription, metric string) (int64, error) {
+	start, _ := BillingPeriod(sub, time.Now().UTC())
+
+	var used int64
+	err := db.DB.Model(&models.UsageRecord{}).
+		Where("user_id = ? AND metric = ? AND period_start = ?", sub.UserID, metric, start).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&used).Error
+	return used, err
+}
+
+// RecalculateUsage rebuilds the rollups of the current period of a
+// subscription from its usage events, returning the quantity of each metric.
+// Metrics without events in the period are reset to zero.
+func RecalculateUsage(tx *gorm.DB, sub models.Subscription) (map[string]int64, error) {
+	now := time.Now().UTC()
+	start, end := BillingPeriod(sub, now)
+
+	var totals []struct {
+		Metric   string
+		Quantity int64
+	}
+	err := tx.Model(&models.UsageEvent{}).
+		Select("metric, SUM(quantity) AS quantity").
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", sub.UserID, start, end).
+		Group("metric").
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]int64)
+	err = tx.Model(&models.UsageRecord{}).
+		Where("user_id = ? AND period_start = ?", sub.UserID, start).
+		Updates(map[string]interface{}{"quantity": 0, "updated_at": now}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, total := range totals {
+		usage[total.Metric] = total.Quantity
+		record := models.UsageRecord{
+			UserID:      sub.UserID,
+			Metric:      total.Metric,
+			PeriodStart: start,
+			PeriodEnd:   end,
+			Quantity:    total.Quantity,
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "metric"}, {Name: "period_start"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"quantity":   total.Quantity,
+				"updated_at": now,
+			}),
+		}).Create(&record).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return usage, nil
+}
+
+// ConsumeQuota meters quantity more of a metric against the user's plan
+// quota and returns the quota status after it. Going over the limit returns
+// ErrQuotaExceeded without metering anything. The check and the increment
+// are one conditional update, so concurrent requests cannot overshoot the
+// quota together.
+func ConsumeQuota(userID uuid.UUID, metric string, quantity int64) (QuotaStatus, error) {
+	sub, err := CurrentSubscription(userID)
+	if err != nil {
+		return QuotaStatus{Metric: metric}, err
+	}
+
+	if sub.Status == config.StatusSuspended {
+		return QuotaStatus{Metric: metric}, ErrSubscriptionSuspended
+	}
+
+	plan := config.GetPlan(sub.PlanKey)
+	limit, limited := plan.Quotas[metric]
+	if !limited {
+		if err := RecordUsage(userID, metric, quantity); err != nil {
+			return QuotaStatus{Metric: metric}, err
+		}
+		return quotaStatus(sub, metric)
+	}
+
+	now := time.Now().UTC()
+	start, end := BillingPeriod(sub, now)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		record := models.UsageRecord{UserID: userID, Metric: metric, PeriodStart: start, PeriodEnd: end}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+			return err
+		}
+
+		result := incrementUsage(tx, record, quantity, limit, now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return quotaExceeded(plan, metric)
+		}
+		return tx.Create(&models.UsageEvent{UserID: userID, Metric: metric, Quantity: quantity}).Error
+	})
+	if err != nil {
+		status, _ := quotaStatus(sub, metric)
+		return status, err
+	}
+	return quotaStatus(sub, metric)
+}
+
+// incrementUsage adds quantity to the rollup of record unless that takes it
+// over limit, in which case no row is affected
+func incrementUsage(tx *gorm.DB, record models.UsageRecord, quantity, limit int64, now time.Time) *gorm.DB {
+	return tx.Model(&models.UsageRecord{}).
+		Where("user_id = ? AND metric = ? AND period_start = ?", record.UserID, record.Metric, record.PeriodStart).
+		Where("quantity + ? <= ?", quantity, limit).
+		Updates(map[string]interface{}{
+			"quantity":   gorm.Expr("quantity + ?", quantity),
+			"updated_at": now,
+		})
+}
+
+// ReleaseQuota gives back quantity consumed by ConsumeQuota for a request
+// that failed
+func ReleaseQuota(userID uuid.UUID, metric string, quantity int64) error {
+	return RecordUsage(userID, metric, -quantity)
+}
+
+// StorageUsed returns the bytes the user stores now. Storage is a gauge
+// rather than metered per period, so replacing or deleting files frees it.
+// Avatars are the only stored files.
+func StorageUsed(userID uuid.UUID) (int64, error) {
+	var used int64
+	err := db.DB.Model(&models.User{}).
+		Where("id = ?", userID).
+		Select("COALESCE(OCTET_LENGTH(avatar), 0)").
+		Scan(&used).Error
+	return used, err
+}
+
+// CheckStorageQuota returns ErrQuotaExceeded when storing an avatar of size
+// bytes would go over the storage quota of the user's plan. The avatar
+// replaces the current one, so concurrent uploads cannot add up past it.
+func CheckStorageQuota(userID uuid.UUID, size int64) error {
+	sub, err := CurrentSubscription(userID)
+	if err != nil {
+		return err
+	}
+
+	return checkLimit(config.GetPlan(sub.PlanKey), config.MetricStorage, size)
+}
+
+// checkLimit returns ErrQuotaExceeded when total goes over the plan's quota
+// for metric
+func checkLimit(plan config.Plan, metric string, total int64) error {
+	if limit, ok := plan.Quotas[metric]; ok && total > limit {
+		return quotaExceeded(plan, metric)
+	}
+	return nil
+}
+
+func quotaExceeded(plan config.Plan, metric string) error {
+	return fmt.Errorf("%w: %s limit of %d reached on the %s plan", ErrQuotaExceeded, metric, plan.Quotas[metric], plan.Name)
+}
+
+// UsageSummary returns the quota status of every metric of the user's plan
+func UsageSummary(sub models.Subscription) ([]QuotaStatus, error) {
+	plan := config.GetPlan(sub.PlanKey)
+
+	metrics := make([]string, 0, len(plan.Quotas))
+	for metric := range plan.Quotas {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	summary := make([]QuotaStatus, 0, len(metrics))
+	for _, metric := range metrics {
+		status, err := quotaStatus(sub, metric)
+		if err != nil {
+			return nil, err
+		}
+		summary = append(summary, status)
+	}
+	return summary, nil
+}
+
+func quotaStatus(sub models.Subscription, metric string) (QuotaStatus, error) {
+	status := QuotaStatus{Metric: metric}
+
+	usage := UsageFor
+	if metric == config.MetricStorage {
+		usage = func(sub models.Subscription, _ string) (int64, error) { return StorageUsed(sub.UserID) }
+	}
+	used, err := usage(sub, metric)
+	if err != nil {
+		return status, err
+	}
+	status.Used = used
+
+	limit, ok := config.GetPlan(sub.PlanKey).Quotas[metric]
+	if !ok {
+		status.Unlimited = true
+		return status, nil
+	}
+	status.Limit = limit
+
+	if limit > 0 {
+		status.Percent = float64(used) / float64(limit) * 100
+	}
+	status.Warning = usageWarning(metric, used, limit)
+	return status, nil
+}
+
+func usageWarning(metric string, used, limit int64) string {
+	if limit <= 0 {
+		return ""
+	}
+
+	var reached float64
+	for _, threshold := range config.GetUsageSoftLimits() {
+		if float64(used) >= threshold*float64(limit) && threshold > reached {
+			reached = threshold
+		}
+	}
+	if reached == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s usage is above %.0f%% of the plan limit (%d/%d)", metric, reached*100, used, limit)
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB builds statements without a database, to check the SQL they run
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	d, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestIncrementUsageIsConditional(t *testing.T) {
+	record := models.UsageRecord{
+		UserID:      uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Metric:      config.MetricAPICalls,
+		PeriodStart: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	now := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	got := dryRunDB(t).ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return incrementUsage(tx, record, 5, 100, now)
+	})
+	want := `UPDATE "usage_records" SET "quantity"=quantity + 5,"updated_at"='2026-01-02 00:00:00' ` +
+		`WHERE (user_id = '00000000-0000-0000-0000-000000000001' AND metric = 'api_calls' AND period_start = '2026-01-01 00:00:00') ` +
+		`AND quantity + 5 <= 100 AND "usage_records"."deleted_at" IS NULL`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestCheckLimit(t *testing.T) {
+	plan := config.Plan{Name: "Test", Quotas: map[string]int64{config.MetricStorage: 100}}
+
+	tests := []struct {
+		metric   string
+		total    int64
+		exceeded bool
+	}{
+		{config.MetricStorage, 0, false},
+		{config.MetricStorage, 100, false},
+		{config.MetricStorage, 101, true},
+		{config.MetricAPICalls, 1 << 40, false},
+	}
+	for _, tt := range tests {
+		err := checkLimit(plan, tt.metric, tt.total)
+		if errors.Is(err, ErrQuotaExceeded) != tt.exceeded {
+			t.Errorf("checkLimit(%s, %d) = %v, want exceeded %v", tt.metric, tt.total, err, tt.exceeded)
+		}
+	}
+}
+
+func TestUsageWarning(t *testing.T) {
+	tests := []struct {
+		limits      string
+		used, limit int64
+		want        string
+	}{
+		{"", 79, 100, ""},
+		{"", 80, 100, "api_calls usage is above 80% of the plan limit (80/100)"},
+		{"", 95, 100, "api_calls usage is above 90% of the plan limit (95/100)"},
+		{"", 150, 100, "api_calls usage is above 90% of the plan limit (150/100)"},
+		{"0.5", 50, 100, "api_calls usage is above 50% of the plan limit (50/100)"},
+		{"0.9,0.5", 60, 100, "api_calls usage is above 50% of the plan limit (60/100)"},
+		{"1.5,abc", 99, 100, ""},
+		{"", 10, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("USAGE_SOFT_LIMITS", tt.limits)
+		if got := usageWarning(config.MetricAPICalls, tt.used, tt.limit); got != tt.want {
+			t.Errorf("USAGE_SOFT_LIMITS=%q usageWarning(%d, %d) = %q, want %q", tt.limits, tt.used, tt.limit, got, tt.want)
+		}
+	}
+}
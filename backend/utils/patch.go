@@ -0,0 +1,356 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Content types of PATCH requests
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// PatchOperation is one operation of a JSON Patch document (RFC 6902)
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// PatchValues applies the patch in the request body to the fields of the
+// update request R that record, a pointer to a model, holds, and returns the
+// values to set with ApplyFieldValues. The body is a JSON Merge Patch
+// (RFC 7396) or a JSON Patch (RFC 6902) according to its content type. The
+// patched document is checked against the binding rules of R. Fields set to
+// null or removed are cleared.
+func PatchValues[R any](c *gin.Context, record any) (map[string]interface{}, bool) {
+	doc, names := patchDocument(reflect.TypeOf((*R)(nil)).Elem(), record)
+
+	var patched any
+	var err error
+	switch c.ContentType() {
+	case MergePatchType:
+		var patch any
+		if err = json.NewDecoder(c.Request.Body).Decode(&patch); err != nil {
+			Respond(c, StatusBadRequest, "Invalid merge patch: "+err.Error(), nil)
+			return nil, false
+		}
+		patched = MergePatch(doc, patch)
+	case JSONPatchType:
+		var ops []PatchOperation
+		if err = json.NewDecoder(c.Request.Body).Decode(&ops); err != nil {
+			Respond(c, StatusBadRequest, "Invalid JSON patch: "+err.Error(), nil)
+			return nil, false
+		}
+		patched, err = ApplyJSONPatch(doc, ops)
+	default:
+		Respond(c, StatusUnsupportedType, "PATCH takes "+MergePatchType+" or "+JSONPatchType, nil)
+		return nil, false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		Respond(c, httpErr.Status, httpErr.Message, nil)
+		return nil, false
+	}
+	if err != nil {
+		Respond(c, StatusUnprocessable, err.Error(), nil)
+		return nil, false
+	}
+
+	fields, ok := patched.(map[string]any)
+	if !ok {
+		Respond(c, StatusUnprocessable, "The patched document must be an object", nil)
+		return nil, false
+	}
+	for key := range fields {
+		if _, ok := names[key]; !ok {
+			Respond(c, StatusUnprocessable, key+" cannot be patched", nil)
+			return nil, false
+		}
+	}
+
+	var req R
+	data, _ := json.Marshal(fields)
+	if err := json.Unmarshal(data, &req); err != nil {
+		ValidationErrorResponse(c, err)
+		return nil, false
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		ValidationErrorResponse(c, err)
+		return nil, false
+	}
+
+	values := ExtractFieldValues(&req)
+	for key, name := range names {
+		if value, ok := fields[key]; !ok || value == nil {
+			values[name] = nil
+		}
+	}
+	return values, true
+}
+
+// patchDocument returns the JSON object of the fields of the request type
+// reqType, holding their values in record, and the names of the struct
+// fields by their JSON keys
+func patchDocument(reqType reflect.Type, record any) (map[string]any, map[string]string) {
+	doc := map[string]any{}
+	names := map[string]string{}
+	recordValue := reflect.Indirect(reflect.ValueOf(record))
+
+	for i := 0; i < reqType.NumField(); i++ {
+		field := reqType.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if key == "-" || !field.IsExported() {
+			continue
+		}
+		if key == "" {
+			key = field.Name
+		}
+		names[key] = field.Name
+
+		var value any
+		if current := recordValue.FieldByName(field.Name); current.IsValid() {
+			data, _ := json.Marshal(current.Interface())
+			json.Unmarshal(data, &value)
+		}
+		doc[key] = value
+	}
+	return doc, names
+}
+
+// MergePatch applies a JSON Merge Patch to target as RFC 7396 describes.
+// Members patched to null are removed.
+func MergePatch(target, patch any) any {
+	fields, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = map[string]any{}
+	}
+	for key, value := range fields {
+		if value == nil {
+			delete(object, key)
+		} else {
+			object[key] = MergePatch(object[key], value)
+		}
+	}
+	return object
+}
+
+// ApplyJSONPatch applies the operations of a JSON Patch to doc in order, as
+// RFC 6902 describes. A failed test answers 409 and any other failure 422,
+// and no operation after it is applied.
+func ApplyJSONPatch(doc any, ops []PatchOperation) (any, error) {
+	for i, op := range ops {
+		var err error
+		if doc, err = applyPatchOperation(doc, op); err != nil {
+			status := StatusUnprocessable
+			var httpErr *HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Status
+			}
+			return nil, NewHTTPError(status, "Operation "+strconv.Itoa(i)+": "+err.Error())
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOperation(doc any, op PatchOperation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, patchError(op.Op + " needs a value")
+		}
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, patchError("invalid value: " + err.Error())
+		}
+		switch op.Op {
+		case "add":
+			return patchAt(doc, path, value, addMember)
+		case "replace":
+			return patchAt(doc, path, value, replaceMember)
+		}
+		current, err := pointerValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, NewHTTPError(StatusConflict, "test of "+op.Path+" failed")
+		}
+		return doc, nil
+	case "remove":
+		if len(path) == 0 {
+			return nil, patchError("cannot remove the document")
+		}
+		return patchAt(doc, path, nil, removeMember)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := pointerValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			data, _ := json.Marshal(value)
+			json.Unmarshal(data, &value)
+		} else {
+			if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, patchError("cannot move " + op.From + " into itself")
+			}
+			if doc, err = patchAt(doc, from, nil, removeMember); err != nil {
+				return nil, err
+			}
+		}
+		return patchAt(doc, path, value, addMember)
+	}
+	return nil, patchError("unknown operation " + strconv.Quote(op.Op))
+}
+
+func patchError(message string) error {
+	return NewHTTPError(StatusUnprocessable, message)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, patchError("invalid path " + strconv.Quote(pointer))
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses the token of an array element. "-" is the index after
+// the last element.
+func arrayIndex(token string, array []any) (int, error) {
+	if token == "-" {
+		return len(array), nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || strconv.Itoa(i) != token {
+		return 0, patchError("invalid array index " + strconv.Quote(token))
+	}
+	return i, nil
+}
+
+func pointerValue(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, patchError(token + " does not exist")
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, node)
+			if err != nil {
+				return nil, err
+			}
+			if i >= len(node) {
+				return nil, patchError("index " + token + " is out of range")
+			}
+			doc = node[i]
+		default:
+			return nil, patchError(token + " does not exist")
+		}
+	}
+	return doc, nil
+}
+
+// memberChange changes the member key of container to value and returns
+// the changed container
+type memberChange func(container any, key string, value any) (any, error)
+
+// patchAt applies change to the parent of the member path points to, and
+// returns the document with the changed parent in place. A change at the
+// root replaces the document.
+func patchAt(doc any, path []string, value any, change memberChange) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	if len(path) == 1 {
+		return change(doc, path[0], value)
+	}
+
+	child, err := pointerValue(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = patchAt(child, path[1:], value, change); err != nil {
+		return nil, err
+	}
+	return replaceMember(doc, path[0], child)
+}
+
+func addMember(container any, key string, value any) (any, error) {
+	switch node := container.(type) {
+	case map[string]any:
+		node[key] = value
+		return node, nil
+	case []any:
+		i, err := arrayIndex(key, node)
+		if err != nil {
+			return nil, err
+		}
+		if i > len(node) {
+			return nil, patchError("index " + key + " is out of range")
+		}
+		return append(node[:i], append([]any{value}, node[i:]...)...), nil
+	}
+	return nil, patchError("cannot add " + key + " to a value")
+}
+
+func replaceMember(container any, key string, value any) (any, error) {
+	if _, err := pointerValue(container, []string{key}); err != nil {
+		return nil, err
+	}
+	switch node := container.(type) {
+	case map[string]any:
+		node[key] = value
+		return node, nil
+	case []any:
+		i, _ := arrayIndex(key, node)
+		node[i] = value
+		return node, nil
+	}
+	return container, nil
+}
+
+func removeMember(container any, key string, _ any) (any, error) {
+	if _, err := pointerValue(container, []string{key}); err != nil {
+		return nil, err
+	}
+	switch node := container.(type) {
+	case map[string]any:
+		delete(node, key)
+		return node, nil
+	case []any:
+		i, _ := arrayIndex(key, node)
+		return append(node[:i], node[i+1:]...), nil
+	}
+	return container, nil
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func decodeJSON(t *testing.T, data string) any {
+	t.Helper()
+	var value any
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	return value
+}
+
+func TestMergePatch(t *testing.T) {
+	// The examples of RFC 7396 appendix A
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"a":false}`, `{"a":true}`, `{"a":true}`},
+	}
+
+	for _, tt := range tests {
+		got := MergePatch(decodeJSON(t, tt.target), decodeJSON(t, tt.patch))
+		if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("MergePatch(%s, %s) = %v, want %v", tt.target, tt.patch, got, want)
+		}
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+		status                 HTTPStatus
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, 0},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`, 0},
+		{"add null", `{"a":1}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`, 0},
+		{"add inserts element", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`, 0},
+		{"add appends with dash", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`, 0},
+		{"add at length", `{"a":[1]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2]}`, 0},
+		{"add past length", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":2}]`, "", StatusUnprocessable},
+		{"add leading zero index", `{"a":[1,2]}`, `[{"op":"add","path":"/a/01","value":2}]`, "", StatusUnprocessable},
+		{"add to missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, "", StatusUnprocessable},
+		{"add replaces root", `{"a":1}`, `[{"op":"add","path":"","value":{"b":2}}]`, `{"b":2}`, 0},
+		{"add without value", `{}`, `[{"op":"add","path":"/a"}]`, "", StatusUnprocessable},
+		{"escaped tokens", `{}`, `[{"op":"add","path":"/a~1b","value":1},{"op":"add","path":"/c~0d","value":2}]`, `{"a/b":1,"c~d":2}`, 0},
+		{"escape order", `{"~1":1}`, `[{"op":"remove","path":"/~01"}]`, `{}`, 0},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`, 0},
+		{"remove element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`, 0},
+		{"remove missing", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, "", StatusUnprocessable},
+		{"remove dash", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`, "", StatusUnprocessable},
+		{"remove root", `{"a":1}`, `[{"op":"remove","path":""}]`, "", StatusUnprocessable},
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":false}]`, `{"a":false}`, 0},
+		{"replace missing", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, "", StatusUnprocessable},
+		{"replace element", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/0","value":3}]`, `{"a":[3,2]}`, 0},
+		{"move member", `{"a":1}`, `[{"op":"move","from":"/a","path":"/b"}]`, `{"b":1}`, 0},
+		{"move element", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`, `{"a":[2,3,1]}`, 0},
+		{"move into itself", `{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`, "", StatusUnprocessable},
+		{"move onto itself", `{"a":1}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":1}`, 0},
+		{"move to sibling prefix", `{"a":1}`, `[{"op":"move","from":"/a","path":"/ab"}]`, `{"ab":1}`, 0},
+		{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, 0},
+		{"copy missing", `{}`, `[{"op":"copy","from":"/a","path":"/b"}]`, "", StatusUnprocessable},
+		{"test equal", `{"a":{"b":[1,"x"]}}`, `[{"op":"test","path":"/a","value":{"b":[1,"x"]}}]`, `{"a":{"b":[1,"x"]}}`, 0},
+		{"test null", `{"a":null}`, `[{"op":"test","path":"/a","value":null}]`, `{"a":null}`, 0},
+		{"test differs", `{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`, "", StatusConflict},
+		{"test missing", `{}`, `[{"op":"test","path":"/a","value":null}]`, "", StatusUnprocessable},
+		{"failure stops patch", `{"a":1}`, `[{"op":"test","path":"/a","value":2},{"op":"remove","path":"/a"}]`, "", StatusConflict},
+		{"unknown operation", `{}`, `[{"op":"merge","path":"/a","value":1}]`, "", StatusUnprocessable},
+		{"invalid path", `{}`, `[{"op":"add","path":"a","value":1}]`, "", StatusUnprocessable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []PatchOperation
+			if err := json.Unmarshal([]byte(tt.patch), &ops); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ApplyJSONPatch(decodeJSON(t, tt.doc), ops)
+			if tt.status != 0 {
+				httpErr, ok := err.(*HTTPError)
+				if !ok || httpErr.Status != tt.status {
+					t.Fatalf("got %v, %v, want status %d", got, err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+type patchTestRecord struct {
+	Name     string
+	Note     string
+	Count    int
+	Enabled  bool
+	Internal string
+}
+
+type patchTestRequest struct {
+	Name    *string `json:"name" binding:"omitempty,min=2"`
+	Note    *string `json:"note"`
+	Count   *int    `json:"count" binding:"omitempty,max=10"`
+	Enabled *bool   `json:"enabled"`
+}
+
+func TestPatchValues(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name, contentType, body string
+		status                  int
+		want                    patchTestRecord
+	}{
+		{"merge sets false", MergePatchType, `{"enabled":false}`, 0,
+			patchTestRecord{Name: "old", Note: "note", Count: 3, Internal: "x"}},
+		{"merge null clears", MergePatchType, `{"note":null,"count":null}`, 0,
+			patchTestRecord{Name: "old", Enabled: true, Internal: "x"}},
+		{"merge empty string", MergePatchType, `{"note":""}`, 0,
+			patchTestRecord{Name: "old", Count: 3, Enabled: true, Internal: "x"}},
+		{"merge leaves others", MergePatchType, `{"name":"new"}`, 0,
+			patchTestRecord{Name: "new", Note: "note", Count: 3, Enabled: true, Internal: "x"}},
+		{"json patch", JSONPatchType, `[{"op":"test","path":"/count","value":3},{"op":"replace","path":"/count","value":4},{"op":"remove","path":"/note"}]`, 0,
+			patchTestRecord{Name: "old", Count: 4, Enabled: true, Internal: "x"}},
+		{"json patch move", JSONPatchType, `[{"op":"move","from":"/name","path":"/note"}]`, 0,
+			patchTestRecord{Note: "old", Count: 3, Enabled: true, Internal: "x"}},
+		{"field outside request", MergePatchType, `{"Internal":"y"}`, http.StatusUnprocessableEntity, patchTestRecord{}},
+		{"binding rules", MergePatchType, `{"count":11}`, http.StatusBadRequest, patchTestRecord{}},
+		{"type mismatch", MergePatchType, `{"count":"many"}`, http.StatusBadRequest, patchTestRecord{}},
+		{"not an object", MergePatchType, `[1]`, http.StatusUnprocessableEntity, patchTestRecord{}},
+		{"malformed body", MergePatchType, `{`, http.StatusBadRequest, patchTestRecord{}},
+		{"failed test", JSONPatchType, `[{"op":"test","path":"/name","value":"other"}]`, http.StatusConflict, patchTestRecord{}},
+		{"plain JSON", "application/json", `{"name":"new"}`, http.StatusUnsupportedMediaType, patchTestRecord{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := patchTestRecord{Name: "old", Note: "note", Count: 3, Enabled: true, Internal: "x"}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+
+			values, ok := PatchValues[patchTestRequest](c, &record)
+			if tt.status != 0 {
+				if ok || w.Code != tt.status {
+					t.Fatalf("got ok=%v status %d %s, want status %d", ok, w.Code, w.Body.String(), tt.status)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+			}
+
+			ApplyFieldValues(&record, values)
+			if record != tt.want {
+				t.Errorf("got %+v, want %+v", record, tt.want)
+			}
+		})
+	}
+}
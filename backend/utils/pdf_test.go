@@ -0,0 +1,19 @@
+package utils
+
+import "testing"
+
+func TestEscapePDFText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Invoice (draft)", `Invoice \(draft\)`},
+		{`C:\x`, `C:\\x`},
+		{"José Müller", `Jos\351 M\374ller`},
+		{"€ 10 – “net”", `\200 10 \226 \223net\224`},
+		{"日本", "??"},
+		{"a\tb", "a?b"},
+	}
+	for _, tt := range tests {
+		if got := escapePDFText(tt.in); got != tt.want {
+			t.Errorf("escapePDFText(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"platform/backend/config"
 	"platform/backend/db"
 	"platform/backend/models"
 
@@ -25,3 +26,14 @@ func IsAdmin(c *gin.Context) bool {
 	return err == nil
 }
 
+// RequireRole responds 403 unless the current user has role. Admins have
+// every role.
+func RequireRole(c *gin.Context, role string) {
+	userID := RequireAuth(c)
+	var user models.User
+	err := db.DB.Select("role").Where("id = ?", userID).First(&user).Error
+	if err != nil || (user.Role != role && user.Role != config.RoleAdmin) {
+		ForbiddenResponse(c, "This action requires the "+role+" role")
+		Abort()
+	}
+}
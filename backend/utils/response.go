@@ -4,6 +4,21 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// HTTPError is an error that answers the request with Status and Message
+// instead of a 500, e.g. a hook refusing a change
+type HTTPError struct {
+	Status  HTTPStatus
+	Message string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+func NewHTTPError(status HTTPStatus, message string) error {
+	return &HTTPError{Status: status, Message: message}
+}
+
 type Response struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message,omitempty"`
@@ -38,6 +53,13 @@ func UnauthorizedResponse(c *gin.Context, message string) {
 	Respond(c, StatusUnauthorized, message, nil)
 }
 
+func ForbiddenResponse(c *gin.Context, message string) {
+	if message == "" {
+		message = "Forbidden"
+	}
+	Respond(c, StatusForbidden, message, nil)
+}
+
 func NotFoundResponse(c *gin.Context, message string) {
 	if message == "" {
 		message = "Resource not found"
@@ -47,4 +69,9 @@ func NotFoundResponse(c *gin.Context, message string) {
 
 func ServerErrorResponse(c *gin.Context, err error) {
 	RespondWithError(c, StatusError, err, "Internal server error")
-} 
\ No newline at end of file
+}
+
+// FieldErrorsResponse responds 400 with the problem of each invalid field
+func FieldErrorsResponse(c *gin.Context, errs FieldErrors) {
+	c.JSON(int(StatusBadRequest), Response{Success: false, Error: "Validation failed", Data: gin.H{"fields": errs}})
+}
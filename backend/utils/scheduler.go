@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"log"
+	"time"
+)
+
+// Every runs fn in the background once per interval for the lifetime of the
+// process. Jobs must be safe to run concurrently on several instances.
+func Every(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			runJob(name, fn)
+		}
+	}()
+}
+
+func runJob(name string, fn func() error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v", name, r)
+		}
+	}()
+
+	if err := fn(); err != nil {
+		log.Printf("Job %s failed: %v", name, err)
+	}
+}
@@ -0,0 +1,276 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/db"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Stat widget kinds
+const (
+	StatCount  = "count"
+	StatSum    = "sum"
+	StatSeries = "series"
+)
+
+// MaxStatBuckets caps the points of a time series
+const MaxStatBuckets = 1000
+
+var statIntervals = map[string]bool{"hour": true, "day": true, "week": true, "month": true}
+
+// StatRange is the time window and bucket size a statistic is computed for
+type StatRange struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Interval string    `json:"interval"`
+}
+
+// StatPoint is one bucket of a time series
+type StatPoint struct {
+	Bucket time.Time `json:"bucket"`
+	Value  float64   `json:"value"`
+}
+
+// StatResult is a computed statistic. Series also carry their total as Value.
+type StatResult struct {
+	Value  float64     `json:"value"`
+	Points []StatPoint `json:"points,omitempty"`
+}
+
+// StatWidget is a dashboard statistic registered by a module
+type StatWidget struct {
+	Key     string                                `json:"key"`
+	Label   string                                `json:"label"`
+	Kind    string                                `json:"kind"`
+	Ranged  bool                                  `json:"ranged"`
+	Compute func(r StatRange) (StatResult, error) `json:"-"`
+}
+
+var (
+	statWidgets = make(map[string]StatWidget)
+
+	statCacheMu sync.Mutex
+	statCache   = make(map[string]statCacheEntry)
+)
+
+type statCacheEntry struct {
+	result  StatResult
+	expires time.Time
+}
+
+func RegisterStatWidget(widget StatWidget) {
+	statWidgets[widget.Key] = widget
+}
+
+// StatWidgets returns the registered widgets ordered by key
+func StatWidgets() []StatWidget {
+	widgets := make([]StatWidget, 0, len(statWidgets))
+	for _, w := range statWidgets {
+		widgets = append(widgets, w)
+	}
+	sort.Slice(widgets, func(i, j int) bool { return widgets[i].Key < widgets[j].Key })
+	return widgets
+}
+
+func GetStatWidget(key string) (StatWidget, bool) {
+	w, ok := statWidgets[key]
+	return w, ok
+}
+
+// ComputeStat computes a widget for r, serving repeated requests from a cache
+// for config.GetAdminStatsTTL
+func ComputeStat(widget StatWidget, r StatRange) (StatResult, error) {
+	cacheKey := widget.Key
+	if widget.Ranged {
+		cacheKey = fmt.Sprintf("%s|%d|%d|%s", widget.Key, r.From.Unix(), r.To.Unix(), r.Interval)
+	}
+
+	statCacheMu.Lock()
+	entry, ok := statCache[cacheKey]
+	statCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.result, nil
+	}
+
+	result, err := widget.Compute(r)
+	if err != nil {
+		return result, err
+	}
+
+	statCacheMu.Lock()
+	for key, entry := range statCache {
+		if time.Now().After(entry.expires) {
+			delete(statCache, key)
+		}
+	}
+	statCache[cacheKey] = statCacheEntry{result: result, expires: time.Now().Add(config.GetAdminStatsTTL())}
+	statCacheMu.Unlock()
+	return result, nil
+}
+
+// ParseStatRange reads from, to and interval parameters. The range defaults
+// to the last 30 days in daily buckets; from and to are RFC 3339 timestamps
+// or dates.
+func ParseStatRange(c *gin.Context) (StatRange, error) {
+	// Whole minutes keep the default range cacheable
+	now := time.Now().UTC().Truncate(time.Minute)
+	r := StatRange{From: now.AddDate(0, 0, -30), To: now, Interval: c.DefaultQuery("interval", "day")}
+
+	for name, target := range map[string]*time.Time{"from": &r.From, "to": &r.To} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			if at, err = time.Parse(time.DateOnly, raw); err != nil {
+				return r, fmt.Errorf("%s must be an RFC 3339 timestamp or a date", name)
+			}
+		}
+		*target = at.UTC()
+	}
+
+	if !statIntervals[r.Interval] {
+		return r, fmt.Errorf("interval must be hour, day, week or month")
+	}
+	if !r.From.Before(r.To) {
+		return r, fmt.Errorf("from must be before to")
+	}
+	if len(statBuckets(r)) > MaxStatBuckets {
+		return r, fmt.Errorf("the range has more than %d %s buckets", MaxStatBuckets, r.Interval)
+	}
+	return r, nil
+}
+
+// CountWidget counts the records of model, within the range by timeColumn
+// when one is given. scope narrows the records counted and may be nil.
+func CountWidget(key, label string, model interface{}, timeColumn string, scope func(*gorm.DB) *gorm.DB) StatWidget {
+	return AggregateWidget(key, label, StatCount, model, "count(*)", timeColumn, scope)
+}
+
+// SumWidget sums column over the records of model like CountWidget
+func SumWidget(key, label string, model interface{}, column, timeColumn string, scope func(*gorm.DB) *gorm.DB) StatWidget {
+	return AggregateWidget(key, label, StatSum, model, sumOf(column), timeColumn, scope)
+}
+
+// AggregateWidget computes a trusted SQL aggregate such as count(DISTINCT
+// user_id) over the records of model like CountWidget
+func AggregateWidget(key, label, kind string, model interface{}, aggregate, timeColumn string, scope func(*gorm.DB) *gorm.DB) StatWidget {
+	return StatWidget{
+		Key:    key,
+		Label:  label,
+		Kind:   kind,
+		Ranged: timeColumn != "",
+		Compute: func(r StatRange) (StatResult, error) {
+			tx := statQuery(model, timeColumn, r, scope)
+			var result StatResult
+			return result, tx.Select(aggregate + " AS value").Scan(&result.Value).Error
+		},
+	}
+}
+
+// SeriesWidget buckets the records of model by timeColumn with date_trunc.
+// Each bucket counts the records, or sums column when it is not "".
+func SeriesWidget(key, label string, model interface{}, column, timeColumn string, scope func(*gorm.DB) *gorm.DB) StatWidget {
+	aggregate := "count(*)"
+	if column != "" {
+		aggregate = sumOf(column)
+	}
+
+	return StatWidget{
+		Key:    key,
+		Label:  label,
+		Kind:   StatSeries,
+		Ranged: true,
+		Compute: func(r StatRange) (StatResult, error) {
+			var rows []StatPoint
+			err := statQuery(model, timeColumn, r, scope).
+				Select("date_trunc(?, ? AT TIME ZONE 'UTC') AS bucket, "+aggregate+" AS value",
+					r.Interval, clause.Column{Name: timeColumn}).
+				Group("bucket").Order("bucket").Scan(&rows).Error
+			if err != nil {
+				return StatResult{}, err
+			}
+			return seriesResult(r, rows), nil
+		},
+	}
+}
+
+func sumOf(column string) string {
+	return fmt.Sprintf("coalesce(sum(%q), 0)", column)
+}
+
+func statQuery(model interface{}, timeColumn string, r StatRange, scope func(*gorm.DB) *gorm.DB) *gorm.DB {
+	tx := db.DB.Model(model)
+	if timeColumn != "" {
+		tx = tx.Where("? >= ? AND ? < ?", clause.Column{Name: timeColumn}, r.From, clause.Column{Name: timeColumn}, r.To)
+	}
+	if scope != nil {
+		tx = scope(tx)
+	}
+	return tx
+}
+
+// seriesResult fills the buckets without records with zero
+func seriesResult(r StatRange, rows []StatPoint) StatResult {
+	values := make(map[time.Time]float64)
+	for _, row := range rows {
+		values[row.Bucket.UTC()] = row.Value
+	}
+
+	var result StatResult
+	for _, bucket := range statBuckets(r) {
+		result.Points = append(result.Points, StatPoint{Bucket: bucket, Value: values[bucket]})
+		result.Value += values[bucket]
+	}
+	return result
+}
+
+// statBuckets returns the start of every bucket in r, truncated the way
+// Postgres date_trunc truncates in UTC
+func statBuckets(r StatRange) []time.Time {
+	var buckets []time.Time
+	for at := truncateStat(r.From, r.Interval); at.Before(r.To); at = nextStatBucket(at, r.Interval) {
+		buckets = append(buckets, at)
+		if len(buckets) > MaxStatBuckets {
+			break
+		}
+	}
+	return buckets
+}
+
+func truncateStat(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	switch interval {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func nextStatBucket(t time.Time, interval string) time.Time {
+	switch interval {
+	case "hour":
+		return t.Add(time.Hour)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
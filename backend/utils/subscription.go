@@ -0,0 +1,429 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/db"
+	"platform/backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrSubscriptionSuspended = errors.New("subscription suspended, please settle outstanding invoices")
+
+// StartSubscription creates the user's subscription through tx, on a free
+// trial of the trial plan when trials are enabled
+func StartSubscription(tx *gorm.DB, userID uuid.UUID) (models.Subscription, error) {
+	now := time.Now().UTC()
+	sub := models.Subscription{
+		UserID:             userID,
+		PlanKey:            config.DefaultPlan,
+		Status:             config.StatusActive,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   now.AddDate(0, 1, 0),
+	}
+
+	if days := config.GetTrialDays(); days > 0 {
+		trialEnd := now.AddDate(0, 0, days)
+		sub.PlanKey = config.GetTrialPlan()
+		sub.Status = config.StatusTrialing
+		sub.TrialEndsAt = &trialEnd
+		sub.CurrentPeriodEnd = trialEnd
+	}
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&sub).Error; err != nil {
+			return err
+		}
+		return logTransition(tx, sub, "", "subscription started")
+	})
+	return sub, err
+}
+
+// endTrial activates a subscription whose trial has ended on the plan chosen
+// at checkout, or on the default plan when the user never checked out
+func endTrial(tx *gorm.DB, sub *models.Subscription) error {
+	reason := "trial ended"
+	if sub.NextPlanKey != "" {
+		sub.PlanKey = sub.NextPlanKey
+		reason += ", continuing on " + sub.PlanKey
+	} else {
+		sub.PlanKey = config.DefaultPlan
+		reason += " without checkout, reverted to " + sub.PlanKey
+	}
+	sub.NextPlanKey = ""
+	return TransitionSubscription(tx, sub, config.StatusActive, reason)
+}
+
+// TransitionSubscription saves sub with a new status and logs the transition
+func TransitionSubscription(tx *gorm.DB, sub *models.Subscription, status, reason string) error {
+	from := sub.Status
+	sub.Status = status
+	if err := tx.Save(sub).Error; err != nil {
+		return err
+	}
+	return logTransition(tx, *sub, from, reason)
+}
+
+func logTransition(tx *gorm.DB, sub models.Subscription, from, reason string) error {
+	log.Printf("Subscription %s: %q -> %q (%s)", sub.ID, from, sub.Status, reason)
+	return tx.Create(&models.SubscriptionEvent{
+		SubscriptionID: sub.ID,
+		FromStatus:     from,
+		ToStatus:       sub.Status,
+		Reason:         reason,
+	}).Error
+}
+
+// CanChangePlan reports whether a subscription is in good standing, so its
+// plan may change. Past due and suspended subscriptions settle their
+// invoices first.
+func CanChangePlan(sub models.Subscription) bool {
+	return sub.Status == config.StatusActive || sub.Status == config.StatusTrialing
+}
+
+// NeedsPlanChange reports whether checking out planKey changes sub: its plan
+// differs, or it is a trial that does not yet continue on planKey
+func NeedsPlanChange(sub models.Subscription, planKey string) bool {
+	if sub.Status == config.StatusTrialing {
+		return sub.NextPlanKey != planKey
+	}
+	return sub.PlanKey != planKey
+}
+
+// CheckoutPlan moves a subscription that CanChangePlan to planKey through tx
+// and redeems the promotion code, if any. The code is redeemed first, so that
+// it discounts the upgrade invoice of ChangePlan, whose ID is returned.
+func CheckoutPlan(tx *gorm.DB, sub *models.Subscription, user models.User, planKey, code string, now time.Time) (*models.CouponRedemption, uuid.UUID, error) {
+	var redemption *models.CouponRedemption
+	if code != "" {
+		var err error
+		if redemption, err = RedeemPromotionCode(tx, *sub, user, code, planKey); err != nil {
+			return nil, uuid.Nil, err
+		}
+	}
+	if !NeedsPlanChange(*sub, planKey) {
+		return redemption, uuid.Nil, nil
+	}
+	invoiceID, err := ChangePlan(tx, sub, planKey, now)
+	return redemption, invoiceID, err
+}
+
+// ChangePlan moves a subscription that CanChangePlan to another plan through
+// tx. Upgrading an active subscription issues an invoice for the price
+// difference over the rest of the period, less the discount of its coupon,
+// whose ID is returned to charge with ChargeInvoice once tx commits. The
+// invoice counts as a period of the coupon. Trials stay free until they end
+// and continue on the plan once they do; downgrades take effect without
+// refund.
+func ChangePlan(tx *gorm.DB, sub *models.Subscription, planKey string, now time.Time) (uuid.UUID, error) {
+	from, to := config.GetPlan(sub.PlanKey), config.GetPlan(planKey)
+	sub.PlanKey = to.Key
+	reason := "plan changed from " + from.Key + " to " + to.Key
+	if sub.Status == config.StatusTrialing {
+		sub.NextPlanKey = to.Key
+		reason += ", continuing after the trial"
+	}
+	if err := TransitionSubscription(tx, sub, sub.Status, reason); err != nil {
+		return uuid.Nil, err
+	}
+	if sub.Status != config.StatusActive || to.Price <= from.Price {
+		return uuid.Nil, nil
+	}
+
+	period := sub.CurrentPeriodEnd.Sub(sub.CurrentPeriodStart)
+	remaining := sub.CurrentPeriodEnd.Sub(now)
+	if period <= 0 || remaining <= 0 {
+		return uuid.Nil, nil
+	}
+	amount := int64(math.Round(float64(to.Price-from.Price) * float64(min(remaining, period)) / float64(period)))
+	if amount <= 0 {
+		return uuid.Nil, nil
+	}
+
+	invoice := models.Invoice{
+		UserID:         sub.UserID,
+		SubscriptionID: sub.ID,
+		PeriodStart:    now,
+		PeriodEnd:      sub.CurrentPeriodEnd,
+	}
+	lines := []models.InvoiceLine{{
+		Description: "Upgrade from " + from.Name + " to " + to.Name + " plan (prorated)",
+		Quantity:    1,
+		UnitAmount:  amount,
+		Amount:      amount,
+	}}
+	lines, err := ApplyDiscount(tx, *sub, lines)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := IssueInvoice(tx, &invoice, lines); err != nil {
+		return uuid.Nil, err
+	}
+	return invoice.ID, nil
+}
+
+// ChargeInvoice collects payment for an open invoice and records the result,
+// putting the subscription past due when the payment fails. The gateway is
+// called outside any transaction, so a rollback never undoes the record of a
+// charge that went through, and mail goes out once the result is committed.
+func ChargeInvoice(invoiceID uuid.UUID) error {
+	var invoice models.Invoice
+	if err := db.DB.First(&invoice, "id = ?", invoiceID).Error; err != nil {
+		return err
+	}
+	if invoice.Status != config.InvoiceStatusOpen {
+		return nil
+	}
+	chargeErr := Payments.Charge(&invoice)
+
+	var mail subscriberNotices
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if chargeErr == nil {
+			return MarkInvoicePaid(tx, &invoice)
+		}
+
+		var sub models.Subscription
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sub, "id = ?", invoice.SubscriptionID).Error
+		if err != nil || sub.Status == config.StatusPastDue {
+			return err
+		}
+		return enterPastDue(tx, &sub, "payment failed for invoice "+invoice.Number+": "+chargeErr.Error(), &mail)
+	})
+	if err == nil {
+		mail.send()
+	}
+	return err
+}
+
+func MarkInvoicePaid(tx *gorm.DB, invoice *models.Invoice) error {
+	invoice.Status = config.InvoiceStatusPaid
+	return tx.Omit(clause.Associations).Save(invoice).Error
+}
+
+// enterPastDue starts the dunning schedule of a subscription
+func enterPastDue(tx *gorm.DB, sub *models.Subscription, reason string, mail *subscriberNotices) error {
+	now := time.Now().UTC()
+	sub.PastDueSince = &now
+	sub.DunningAttempts = 0
+	sub.NextDunningAt = dunningDate(now, 0)
+
+	if err := TransitionSubscription(tx, sub, config.StatusPastDue, reason); err != nil {
+		return err
+	}
+
+	body := "We could not process your latest payment."
+	if sub.NextDunningAt != nil {
+		body += fmt.Sprintf(" We will retry on %s.", sub.NextDunningAt.Format("2006-01-02"))
+	}
+	mail.add(*sub, "Payment failed", body)
+	return nil
+}
+
+func dunningDate(since time.Time, attempt int) *time.Time {
+	schedule := config.GetDunningSchedule()
+	if attempt >= len(schedule) {
+		return nil
+	}
+	date := since.AddDate(0, 0, schedule[attempt])
+	return &date
+}
+
+// SendTrialReminders emails users whose trial ends within the reminder window
+func SendTrialReminders(now time.Time) error {
+	cutoff := now.AddDate(0, 0, config.GetTrialReminderDays())
+
+	var due []models.Subscription
+	err := db.DB.Where("status = ? AND trial_reminder_sent_at IS NULL AND trial_ends_at <= ?", config.StatusTrialing, cutoff).
+		Find(&due).Error
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range due {
+		// Claim the reminder first so concurrent instances send it only once
+		result := db.DB.Model(&models.Subscription{}).
+			Where("id = ? AND trial_reminder_sent_at IS NULL", sub.ID).
+			Update("trial_reminder_sent_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		plan := config.GetPlan(sub.PlanKey)
+		body := fmt.Sprintf("Your free trial of the %s plan ends on %s.", plan.Name, sub.TrialEndsAt.Format("2006-01-02"))
+		if sub.NextPlanKey != "" {
+			body += fmt.Sprintf(" Your subscription continues on the %s plan afterwards.", config.GetPlan(sub.NextPlanKey).Name)
+		} else {
+			body += fmt.Sprintf(" Check out to keep it, otherwise you move to the %s plan.", config.GetPlan(config.DefaultPlan).Name)
+		}
+		notifySubscriber(sub, "Your trial is ending soon", body)
+	}
+	return nil
+}
+
+// ProcessDunning retries payment of past due subscriptions whose next retry
+// is due and ends the schedule once all retries have failed
+func ProcessDunning(now time.Time) error {
+	var due []models.Subscription
+	err := db.DB.Where("status = ? AND (next_dunning_at IS NULL OR next_dunning_at <= ?)", config.StatusPastDue, now).
+		Find(&due).Error
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range due {
+		if err := runDunning(sub.ID, now); err != nil {
+			log.Printf("Dunning failed for subscription %s: %v", sub.ID, err)
+		}
+	}
+	return nil
+}
+
+// dunningLease is how long a dunning run holds a subscription. A run that
+// fails to record its result is retried once the lease ends.
+const dunningLease = time.Hour
+
+func runDunning(id uuid.UUID, now time.Time) error {
+	// Claim the run first so concurrent instances charge only once
+	lease := now.Add(dunningLease)
+	result := db.DB.Model(&models.Subscription{}).
+		Where("id = ? AND status = ? AND (next_dunning_at IS NULL OR next_dunning_at <= ?)", id, config.StatusPastDue, now).
+		Update("next_dunning_at", lease)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	var invoices []models.Invoice
+	err := db.DB.Where("subscription_id = ? AND status = ?", id, config.InvoiceStatusOpen).Find(&invoices).Error
+	if err != nil {
+		return err
+	}
+
+	// Payments run outside the transaction recording them, see ChargeInvoice
+	var paid []*models.Invoice
+	failed := 0
+	for i := range invoices {
+		if err := Payments.Charge(&invoices[i]); err != nil {
+			failed++
+			continue
+		}
+		paid = append(paid, &invoices[i])
+	}
+
+	var mail subscriberNotices
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, invoice := range paid {
+			if err := MarkInvoicePaid(tx, invoice); err != nil {
+				return err
+			}
+		}
+
+		var sub models.Subscription
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ?", id, config.StatusPastDue).
+			First(&sub).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if failed == 0 {
+			clearDunning(&sub)
+			if err := TransitionSubscription(tx, &sub, config.StatusActive, "outstanding invoices paid"); err != nil {
+				return err
+			}
+			mail.add(sub, "Payment received", "Thank you, your outstanding invoices have been paid.")
+			return nil
+		}
+
+		sub.DunningAttempts++
+		since := now
+		if sub.PastDueSince != nil {
+			since = *sub.PastDueSince
+		}
+
+		if next := dunningDate(since, sub.DunningAttempts); next != nil {
+			sub.NextDunningAt = next
+			if err := tx.Save(&sub).Error; err != nil {
+				return err
+			}
+			mail.add(sub, "Payment retry failed", fmt.Sprintf(
+				"We could not collect %d outstanding invoice(s). We will retry on %s.", failed, next.Format("2006-01-02")))
+			return nil
+		}
+
+		return endDunning(tx, &sub, &mail)
+	})
+	if err == nil {
+		mail.send()
+	}
+	return err
+}
+
+// endDunning downgrades or suspends a subscription whose retries all failed
+func endDunning(tx *gorm.DB, sub *models.Subscription, mail *subscriberNotices) error {
+	clearDunning(sub)
+
+	if config.GetDunningFinalAction() == "suspend" {
+		if err := TransitionSubscription(tx, sub, config.StatusSuspended, "dunning schedule exhausted"); err != nil {
+			return err
+		}
+		mail.add(*sub, "Your account has been suspended",
+			"We were unable to collect payment. Access is suspended until your outstanding invoices are paid.")
+		return nil
+	}
+
+	previous := config.GetPlan(sub.PlanKey)
+	sub.PlanKey = config.DefaultPlan
+	if err := TransitionSubscription(tx, sub, config.StatusActive, "dunning schedule exhausted, downgraded from "+previous.Key); err != nil {
+		return err
+	}
+	mail.add(*sub, "Your plan has been downgraded", fmt.Sprintf(
+		"We were unable to collect payment, so your %s plan was downgraded to %s.", previous.Name, config.GetPlan(sub.PlanKey).Name))
+	return nil
+}
+
+func clearDunning(sub *models.Subscription) {
+	sub.PastDueSince = nil
+	sub.DunningAttempts = 0
+	sub.NextDunningAt = nil
+}
+
+// subscriberNotices collects the emails of a transaction, to send once it
+// has committed
+type subscriberNotices []subscriberNotice
+
+type subscriberNotice struct {
+	sub           models.Subscription
+	subject, body string
+}
+
+func (n *subscriberNotices) add(sub models.Subscription, subject, body string) {
+	*n = append(*n, subscriberNotice{sub: sub, subject: subject, body: body})
+}
+
+func (n subscriberNotices) send() {
+	for _, notice := range n {
+		notifySubscriber(notice.sub, notice.subject, notice.body)
+	}
+}
+
+func notifySubscriber(sub models.Subscription, subject, body string) {
+	var user models.User
+	if err := db.DB.First(&user, "id = ?", sub.UserID).Error; err != nil {
+		log.Printf("Cannot notify subscriber %s: %v", sub.UserID, err)
+		return
+	}
+	if err := SendMail(user.Email, subject, body); err != nil {
+		log.Printf("Failed to send %q to %s: %v", subject, user.Email, err)
+	}
+}
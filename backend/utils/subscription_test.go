@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"platform/backend/config"
+	"platform/backend/db"
+	"platform/backend/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	updateColumn  = regexp.MustCompile(`"(\w+)"=\$(\d+)`)
+	insertColumns = regexp.MustCompile(`^INSERT INTO "\w+" \(([^)]*)\)`)
+)
+
+// statementValues maps the columns an INSERT or UPDATE sets to their values
+func statementValues(s fakeStatement) map[string]driver.Value {
+	values := map[string]driver.Value{}
+	if match := insertColumns.FindStringSubmatch(s.query); match != nil {
+		for i, column := range strings.Split(match[1], ",") {
+			values[strings.Trim(column, `"`)] = s.args[i]
+		}
+		return values
+	}
+	for _, match := range updateColumn.FindAllStringSubmatch(s.query, -1) {
+		i, _ := strconv.Atoi(match[2])
+		values[match[1]] = s.args[i-1]
+	}
+	return values
+}
+
+func TestCloseBillingPeriodEndsTrial(t *testing.T) {
+	t.Setenv("TRIAL_PLAN", config.PlanPro)
+	now := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	start, end := now.AddDate(0, 0, -14), now.AddDate(0, 0, -1)
+
+	tests := []struct {
+		nextPlan, plan, reason string
+	}{
+		{"", config.DefaultPlan, "trial ended without checkout, reverted to " + config.DefaultPlan},
+		{config.PlanPro, config.PlanPro, "trial ended, continuing on " + config.PlanPro},
+	}
+
+	for _, tt := range tests {
+		id := uuid.New()
+		f := fakeDB(t, func(query string, _ []driver.Value) []map[string]driver.Value {
+			if !strings.HasPrefix(query, `SELECT * FROM "subscriptions"`) {
+				return nil
+			}
+			return []map[string]driver.Value{{
+				"id":                   id.String(),
+				"user_id":              uuid.NewString(),
+				"plan_key":             config.PlanPro,
+				"next_plan_key":        tt.nextPlan,
+				"status":               config.StatusTrialing,
+				"current_period_start": start,
+				"current_period_end":   end,
+				"trial_ends_at":        end,
+			}}
+		})
+
+		if err := closeBillingPeriod(id, now); err != nil {
+			t.Fatal(err)
+		}
+
+		if invoices := f.find(`INSERT INTO "invoices"`); len(invoices) != 0 {
+			t.Errorf("next plan %q: trial was invoiced", tt.nextPlan)
+		}
+		updates := f.find(`UPDATE "subscriptions"`)
+		if len(updates) != 1 {
+			t.Fatalf("next plan %q: got %d subscription updates, want 1", tt.nextPlan, len(updates))
+		}
+		saved := statementValues(updates[0])
+		if saved["plan_key"] != tt.plan || saved["status"] != config.StatusActive || saved["next_plan_key"] != "" {
+			t.Errorf("next plan %q: saved plan %v, status %v, next plan %v, want %s, %s and none",
+				tt.nextPlan, saved["plan_key"], saved["status"], saved["next_plan_key"], tt.plan, config.StatusActive)
+		}
+		if !saved["current_period_start"].(time.Time).Equal(end) {
+			t.Errorf("next plan %q: period starts %v, want %v", tt.nextPlan, saved["current_period_start"], end)
+		}
+
+		events := f.find(`INSERT INTO "subscription_events"`)
+		if len(events) != 1 || statementValues(events[0])["reason"] != tt.reason {
+			t.Errorf("next plan %q: got events %v, want reason %q", tt.nextPlan, events, tt.reason)
+		}
+		if len(f.find("COMMIT")) != 1 {
+			t.Errorf("next plan %q: transaction was not committed", tt.nextPlan)
+		}
+	}
+}
+
+func TestCheckoutPlanDiscountsUpgrade(t *testing.T) {
+	t.Setenv("BILLING_TAX_RATE", "0")
+	now := time.Date(2026, 2, 11, 0, 0, 0, 0, time.UTC)
+	couponID := uuid.New()
+
+	var f *fakeSQL
+	f = fakeDB(t, func(query string, _ []driver.Value) []map[string]driver.Value {
+		switch {
+		case strings.HasPrefix(query, `SELECT * FROM "promotion_codes"`):
+			return []map[string]driver.Value{{
+				"id": uuid.NewString(), "code": "HALF", "coupon_id": couponID.String(), "active": true,
+			}}
+		case strings.HasPrefix(query, `SELECT * FROM "coupons"`):
+			return []map[string]driver.Value{{
+				"id": couponID.String(), "name": "Half off", "percent_off": 50.0,
+				"duration": config.CouponDurationOnce, "plans": []byte(`["pro"]`),
+			}}
+		case strings.HasPrefix(query, `SELECT * FROM "coupon_redemptions"`):
+			// The redemption exists once the code was redeemed
+			if len(f.find(`INSERT INTO "coupon_redemptions"`)) == 0 {
+				return nil
+			}
+			return []map[string]driver.Value{{"id": uuid.NewString(), "coupon_id": couponID.String()}}
+		}
+		return nil
+	})
+
+	sub := models.Subscription{
+		UserID:             uuid.New(),
+		PlanKey:            config.PlanFree,
+		Status:             config.StatusActive,
+		CurrentPeriodStart: now.AddDate(0, 0, -10),
+		CurrentPeriodEnd:   now.AddDate(0, 0, 20),
+	}
+	sub.ID = uuid.New()
+	user := models.User{}
+	user.ID = sub.UserID
+
+	redemption, invoiceID, err := CheckoutPlan(db.DB, &sub, user, config.PlanPro, "half", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redemption == nil || invoiceID == uuid.Nil {
+		t.Fatalf("got redemption %v and invoice %s", redemption, invoiceID)
+	}
+
+	invoices := f.find(`INSERT INTO "invoices"`)
+	if len(invoices) != 1 {
+		t.Fatalf("got %d invoices, want 1", len(invoices))
+	}
+	// 20 of 30 days of the price difference, half off
+	prorated := int64(2900 * 20 / 30)
+	want := prorated - (prorated+1)/2
+	if got := statementValues(invoices[0])["total"]; got != want {
+		t.Errorf("upgrade invoice total %v, want %d", got, want)
+	}
+}
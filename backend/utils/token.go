@@ -5,12 +5,24 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
+	"platform/backend/config"
+	"platform/backend/db"
+	"platform/backend/models"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+func init() {
+	// Tokens issued in the second their user was logged out, after the
+	// logout, stay valid
+	jwt.TimePrecision = time.Microsecond
+}
+
 type TokenClaims struct {
 	UserID uuid.UUID `json:"userId"`
 	jwt.RegisteredClaims
@@ -56,6 +68,10 @@ func ValidateToken(tokenString string) (uuid.UUID, error) {
 	}
 
 	if claims, ok := token.Claims.(*TokenClaims); ok && token.Valid {
+		if err := checkTokenRevoked(claims); err != nil {
+			log.Printf("Rejected token for user %s: %v", claims.UserID, err)
+			return uuid.Nil, err
+		}
 		log.Printf("Token validated successfully for user: %s", claims.UserID)
 		return claims.UserID, nil
 	}
@@ -73,3 +89,77 @@ func getJWTExpiry() time.Duration {
 	expiry, _ := time.ParseDuration(expiryStr)
 	return expiry
 }
+
+// checkTokenRevoked rejects tokens issued no later than the user's
+// TokensValidAfter, which logging a user out everywhere moves forward
+func checkTokenRevoked(claims *TokenClaims) error {
+	validAfter, err := tokensValidAfter(claims.UserID)
+	if err != nil {
+		return err
+	}
+	if validAfter == nil {
+		return nil
+	}
+	if claims.IssuedAt == nil || !claims.IssuedAt.Time.After(*validAfter) {
+		return errors.New("token has been revoked")
+	}
+	return nil
+}
+
+var (
+	revocationsMu sync.Mutex
+	revocations   = make(map[uuid.UUID]revocation)
+	// forgotten counts ForgetTokensValidAfter calls, so that a time read
+	// before a revocation is not cached after it
+	forgotten uint64
+)
+
+type revocation struct {
+	validAfter *time.Time
+	expires    time.Time
+}
+
+// tokensValidAfter returns the TokensValidAfter of a user, cached for
+// config.GetTokenRevocationTTL so that requests need not read it
+func tokensValidAfter(userID uuid.UUID) (*time.Time, error) {
+	revocationsMu.Lock()
+	entry, ok := revocations[userID]
+	generation := forgotten
+	revocationsMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.validAfter, nil
+	}
+
+	var user models.User
+	err := db.DB.Select("tokens_valid_after").Where("id = ?", userID).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl := config.GetTokenRevocationTTL(); ttl > 0 {
+		revocationsMu.Lock()
+		defer revocationsMu.Unlock()
+		if generation != forgotten {
+			return user.TokensValidAfter, nil
+		}
+		for id, entry := range revocations {
+			if time.Now().After(entry.expires) {
+				delete(revocations, id)
+			}
+		}
+		revocations[userID] = revocation{validAfter: user.TokensValidAfter, expires: time.Now().Add(ttl)}
+	}
+	return user.TokensValidAfter, nil
+}
+
+// ForgetTokensValidAfter drops the cached TokensValidAfter of a user, so
+// that a revocation applies to the next request
+func ForgetTokensValidAfter(userID uuid.UUID) {
+	revocationsMu.Lock()
+	defer revocationsMu.Unlock()
+	delete(revocations, userID)
+	forgotten++
+}
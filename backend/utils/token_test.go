@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestCheckTokenRevoked(t *testing.T) {
+	userID := uuid.New()
+	validAfter := time.Date(2026, 1, 2, 3, 4, 5, 500000000, time.UTC)
+	revocations[userID] = revocation{validAfter: &validAfter, expires: time.Now().Add(time.Minute)}
+	defer ForgetTokensValidAfter(userID)
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		revoked  bool
+	}{
+		{"earlier second", validAfter.Add(-time.Second), true},
+		{"same second before", validAfter.Add(-time.Millisecond), true},
+		{"same second after", validAfter.Add(time.Millisecond), false},
+		{"later", validAfter.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		claims := &TokenClaims{UserID: userID}
+		claims.IssuedAt = jwt.NewNumericDate(tt.issuedAt)
+		if err := checkTokenRevoked(claims); (err != nil) != tt.revoked {
+			t.Errorf("%s: got %v, want revoked %v", tt.name, err, tt.revoked)
+		}
+	}
+}
+
+func TestTokenIssuedAtPrecision(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("JWT_EXPIRY", "1h")
+
+	userID := uuid.New()
+	noRevocation := revocation{expires: time.Now().Add(time.Minute)}
+	revocations[userID] = noRevocation
+	defer ForgetTokensValidAfter(userID)
+
+	before := time.Now()
+	token, err := GenerateToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &TokenClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte("test-secret"), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if claims.IssuedAt.Time.Before(before.Truncate(time.Microsecond)) {
+		t.Errorf("issued at %s, before the token was generated at %s", claims.IssuedAt.Time, before)
+	}
+
+	if id, err := ValidateToken(token); err != nil || id != userID {
+		t.Errorf("got %s, %v", id, err)
+	}
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"platform/backend/db"
+	"platform/backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Version events
+const (
+	VersionCreate = "create"
+	VersionUpdate = "update"
+	VersionDelete = "delete"
+	VersionRevert = "revert"
+)
+
+// revertSetting carries the number of the version a save reverts to from
+// RevertToVersion to the update callback
+const revertSetting = "versions:revert"
+
+// versionedModel is implemented by models embedding models.Versioned
+type versionedModel interface {
+	KeepsVersions()
+}
+
+var versionedType = reflect.TypeOf((*versionedModel)(nil)).Elem()
+
+// affectedSetting carries the IDs of the records an update changes from
+// before the update to the callback storing their versions
+const affectedSetting = "versions:affected"
+
+// RegisterVersioning adds the callbacks that store a version of every
+// versioned admin resource record created, updated or deleted through d,
+// including the records that updates and deletes by condition change.
+// The author is the userID of the statement context, so handlers pass their
+// gin context with WithContext.
+func RegisterVersioning(d *gorm.DB) error {
+	if err := d.Callback().Create().After("gorm:create").Register("versions:create", recordVersions(VersionCreate)); err != nil {
+		return err
+	}
+	// Updates find the records they change while their conditions match
+	if err := d.Callback().Update().Before("gorm:update").Register("versions:affected", rememberAffected); err != nil {
+		return err
+	}
+	if err := d.Callback().Update().After("gorm:update").Register("versions:update", recordVersions(VersionUpdate)); err != nil {
+		return err
+	}
+	// Deletes snapshot the record while it still exists
+	return d.Callback().Delete().Before("gorm:delete").Register("versions:delete", recordVersions(VersionDelete))
+}
+
+// versionedStatement returns the admin resource of the versioned model a
+// statement changes, or nil
+func versionedStatement(tx *gorm.DB) *ResourceMetadata {
+	if tx.Error != nil || tx.DryRun || tx.Statement.Schema == nil || tx.Statement.Schema.PrioritizedPrimaryField == nil {
+		return nil
+	}
+	return versionedResource(tx.Statement.Schema.ModelType)
+}
+
+func rememberAffected(tx *gorm.DB) {
+	if versionedStatement(tx) == nil {
+		return
+	}
+	ids, err := affectedIDs(tx)
+	if err != nil {
+		tx.AddError(err)
+		return
+	}
+	tx.Statement.Settings.Store(affectedSetting, ids)
+}
+
+func recordVersions(event string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		// A chain reused for another update finds its own records
+		affected, remembered := tx.Statement.Settings.LoadAndDelete(affectedSetting)
+		metadata := versionedStatement(tx)
+		if metadata == nil || (event != VersionDelete && tx.Statement.RowsAffected == 0) {
+			return
+		}
+
+		ids, _ := affected.([]any)
+		if !remembered {
+			var err error
+			if ids, err = affectedIDs(tx); err != nil {
+				tx.AddError(err)
+				return
+			}
+		}
+		for _, id := range ids {
+			if err := recordVersion(tx, metadata, event, id); err != nil {
+				tx.AddError(err)
+				return
+			}
+		}
+	}
+}
+
+// affectedIDs returns the primary keys of the records a statement changes:
+// those of its model, or of the records its conditions match when the model
+// has none, as in Model(&T{}).Where(...).Updates(...)
+func affectedIDs(tx *gorm.DB) ([]any, error) {
+	primaryKey := tx.Statement.Schema.PrioritizedPrimaryField
+	records := reflect.Indirect(tx.Statement.ReflectValue)
+	if records.Kind() == reflect.Struct {
+		records = reflect.Append(reflect.MakeSlice(reflect.SliceOf(records.Type()), 0, 1), records)
+	}
+	if records.Kind() != reflect.Slice && records.Kind() != reflect.Array {
+		return matchingIDs(tx)
+	}
+
+	var ids []any
+	for i := 0; i < records.Len(); i++ {
+		id, zero := primaryKey.ValueOf(tx.Statement.Context, reflect.Indirect(records.Index(i)))
+		if zero {
+			return matchingIDs(tx)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return matchingIDs(tx)
+	}
+	return ids, nil
+}
+
+// matchingIDs selects the primary keys of the records matching the
+// conditions of a statement. Statements without conditions match nothing,
+// as gorm refuses to run them.
+func matchingIDs(tx *gorm.DB) ([]any, error) {
+	where, ok := tx.Statement.Clauses["WHERE"]
+	if !ok {
+		return nil, nil
+	}
+
+	primaryKey := tx.Statement.Schema.PrioritizedPrimaryField
+	session := tx.Session(&gorm.Session{NewDB: true}).Model(reflect.New(tx.Statement.Schema.ModelType).Interface())
+	if tx.Statement.Unscoped {
+		session = session.Unscoped()
+	}
+	found := reflect.New(reflect.SliceOf(primaryKey.FieldType))
+	if err := session.Clauses(where.Expression).Pluck(primaryKey.DBName, found.Interface()).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]any, found.Elem().Len())
+	for i := range ids {
+		ids[i] = found.Elem().Index(i).Interface()
+	}
+	return ids, nil
+}
+
+// recordVersion stores the current state of the record with primary key id
+// as its next version. Records are reloaded so that partial updates store
+// every field, and locked so that concurrent changes of a record number
+// their versions one after the other.
+func recordVersion(tx *gorm.DB, metadata *ResourceMetadata, event string, id any) error {
+	primaryKey := tx.Statement.Schema.PrioritizedPrimaryField
+	session := tx.Session(&gorm.Session{NewDB: true})
+	current := reflect.New(metadata.ModelType)
+	err := session.Unscoped().
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(clause.Eq{Column: clause.Column{Name: primaryKey.DBName}, Value: id}).
+		Take(current.Interface()).Error
+	if err != nil {
+		return err
+	}
+
+	version := models.RecordVersion{
+		Resource: metadata.Name,
+		RecordID: fmt.Sprint(id),
+		Event:    event,
+		Data:     SnapshotRecord(current.Interface()),
+	}
+	if number, ok := tx.Get(revertSetting); ok && event == VersionUpdate {
+		revertOf := number.(int)
+		version.Event = VersionRevert
+		version.RevertOf = &revertOf
+	}
+	if author, ok := tx.Statement.Context.Value("userID").(uuid.UUID); ok && author != uuid.Nil {
+		version.AuthorID = &author
+	}
+
+	err = session.Model(&models.RecordVersion{}).
+		Where("resource = ? AND record_id = ?", version.Resource, version.RecordID).
+		Select("COALESCE(MAX(number), 0) + 1").
+		Scan(&version.Number).Error
+	if err != nil {
+		return err
+	}
+	return session.Create(&version).Error
+}
+
+// versionedResource returns the admin resource of a model that keeps
+// versions, or nil
+func versionedResource(t reflect.Type) *ResourceMetadata {
+	for _, m := range adminResources {
+		if m.ModelType == t && m.Versioned {
+			return m
+		}
+	}
+	return nil
+}
+
+// ListVersions returns a page of the versions of a record, newest first
+func ListVersions(metadata *ResourceMetadata, recordID string, query ListQuery) ([]models.RecordVersion, int64, error) {
+	versions := []models.RecordVersion{}
+	var total int64
+
+	tx := db.DB.Model(&models.RecordVersion{}).Where("resource = ? AND record_id = ?", metadata.Name, recordID)
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Paginate(tx).Order("number DESC").Find(&versions).Error
+	return versions, total, err
+}
+
+// GetVersion returns version number of a record. Number 0 is the latest.
+func GetVersion(metadata *ResourceMetadata, recordID string, number int) (models.RecordVersion, error) {
+	var version models.RecordVersion
+	tx := db.DB.Where("resource = ? AND record_id = ?", metadata.Name, recordID)
+	if number > 0 {
+		tx = tx.Where("number = ?", number)
+	}
+	err := tx.Order("number DESC").First(&version).Error
+	return version, err
+}
+
+// DiffVersions returns the fields that differ between two versions
+func DiffVersions(from, to models.RecordVersion) map[string]models.AuditChange {
+	return auditDiff(from.Data, to.Data)
+}
+
+// RevertToVersion sets the editable fields of record, a pointer to the
+// resource's model, back to their values in version and saves it through tx.
+// The save is stored as a new version, so history is never rewritten.
+func RevertToVersion(tx *gorm.DB, metadata *ResourceMetadata, record reflect.Value, version models.RecordVersion) (FieldErrors, error) {
+	values := make(map[string]interface{})
+	for _, f := range metadata.Fields {
+		raw, ok := version.Data[f.Name]
+		if !ok || !f.Editable {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		values[f.Name] = value
+	}
+
+	if errs := ApplyAdminValues(metadata, record.Elem(), values); len(errs) > 0 {
+		return errs, nil
+	}
+	return nil, SaveIfUnchanged(tx.Set(revertSetting, version.Number), record.Interface())
+}
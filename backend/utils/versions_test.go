@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"platform/backend/db"
+	"platform/backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder is a gorm logger that keeps the statements it is given
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+func recordingDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	return dryRunDB(t).Session(&gorm.Session{Logger: recorder, SkipDefaultTransaction: true}), recorder
+}
+
+func settingResource() *ResourceMetadata {
+	modelType := reflect.TypeOf(models.Setting{})
+	return &ResourceMetadata{Name: "setting", ModelType: modelType, Fields: extractFields(modelType, nil), Versioned: true}
+}
+
+func TestRecordVersionLocksRecord(t *testing.T) {
+	d, recorder := recordingDB(t)
+	setting := models.Setting{ID: uuid.MustParse("00000000-0000-0000-0000-000000000001"), Key: "theme"}
+
+	tx := d.Model(&setting)
+	if err := tx.Statement.Parse(&setting); err != nil {
+		t.Fatal(err)
+	}
+	// Dry runs cannot scan the next number, so the version is not stored
+	err := recordVersion(tx, settingResource(), VersionUpdate, setting.ID)
+	if !errors.Is(err, gorm.ErrDryRunModeUnsupported) {
+		t.Fatalf("got error %v", err)
+	}
+
+	if len(recorder.statements) == 0 {
+		t.Fatal("no statements ran")
+	}
+	if reload := recorder.statements[0]; !strings.HasPrefix(reload, `SELECT * FROM "settings"`) || !strings.HasSuffix(reload, "FOR UPDATE") {
+		t.Errorf("the record is not locked before numbering its version: %s", reload)
+	}
+}
+
+func TestDiffVersions(t *testing.T) {
+	from := models.RecordVersion{Data: map[string]json.RawMessage{
+		"key": json.RawMessage(`"theme"`), "value": json.RawMessage(`"dark"`),
+		"isPublic": json.RawMessage(`false`), "updatedAt": json.RawMessage(`"2026-01-01T00:00:00Z"`),
+	}}
+	to := models.RecordVersion{Data: map[string]json.RawMessage{
+		"key": json.RawMessage(`"theme"`), "value": json.RawMessage(`"light"`),
+		"category": json.RawMessage(`"ui"`), "updatedAt": json.RawMessage(`"2026-01-02T00:00:00Z"`),
+	}}
+
+	want := map[string]models.AuditChange{
+		"value":    {Before: json.RawMessage(`"dark"`), After: json.RawMessage(`"light"`)},
+		"category": {After: json.RawMessage(`"ui"`)},
+		"isPublic": {Before: json.RawMessage(`false`)},
+	}
+	if got := DiffVersions(from, to); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRevertToVersion(t *testing.T) {
+	d, recorder := recordingDB(t)
+	updatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	setting := &models.Setting{
+		ID:        uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Key:       "theme",
+		Value:     "light",
+		Category:  "ui",
+		UpdatedAt: updatedAt,
+	}
+	version := models.RecordVersion{Number: 2, Data: map[string]json.RawMessage{
+		"id":       json.RawMessage(`"00000000-0000-0000-0000-000000000002"`),
+		"key":      json.RawMessage(`"theme"`),
+		"value":    json.RawMessage(`"dark"`),
+		"category": json.RawMessage(`"general"`),
+		"isPublic": json.RawMessage(`true`),
+	}}
+
+	errs, err := RevertToVersion(d, settingResource(), reflect.ValueOf(setting), version)
+	if len(errs) > 0 {
+		t.Fatalf("got field errors %v", errs)
+	}
+	// A dry run affects no rows, which reads as a concurrent change
+	if !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("got error %v", err)
+	}
+
+	if setting.Value != "dark" || setting.Category != "general" || !setting.IsPublic {
+		t.Errorf("editable fields were not reverted: %+v", setting)
+	}
+	if setting.ID != uuid.MustParse("00000000-0000-0000-0000-000000000001") {
+		t.Errorf("the read-only ID was reverted to %s", setting.ID)
+	}
+	if len(recorder.statements) != 1 || !strings.Contains(recorder.statements[0], `"settings"."updated_at" = '2026-01-02 03:04:05'`) {
+		t.Errorf("the save is not conditional on the read record: %q", recorder.statements)
+	}
+}
+
+func TestRecordVersionsOfConditionalWrites(t *testing.T) {
+	adminResources["setting"] = settingResource()
+	defer delete(adminResources, "setting")
+	matching := []string{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"}
+
+	f := fakeDB(t, func(query string, args []driver.Value) []map[string]driver.Value {
+		switch {
+		case strings.HasPrefix(query, `SELECT "id" FROM "settings"`):
+			var rows []map[string]driver.Value
+			for _, id := range matching {
+				rows = append(rows, map[string]driver.Value{"id": id})
+			}
+			return rows
+		case strings.HasPrefix(query, `SELECT * FROM "settings"`):
+			return []map[string]driver.Value{{"id": args[0], "key": "theme"}}
+		}
+		return nil
+	})
+	if err := RegisterVersioning(db.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		event, change string
+		write         func(*gorm.DB) error
+	}{
+		{VersionUpdate, `UPDATE "settings"`, func(d *gorm.DB) error {
+			return d.Model(&models.Setting{}).Where("category = ?", "ui").Update("is_public", false).Error
+		}},
+		{VersionDelete, `DELETE FROM "settings"`, func(d *gorm.DB) error {
+			return d.Where("category = ?", "ui").Delete(&models.Setting{}).Error
+		}},
+	}
+
+	for _, tt := range tests {
+		f.statements = nil
+		if err := tt.write(db.DB); err != nil {
+			t.Fatal(err)
+		}
+
+		var order []string
+		var recorded []string
+		for _, s := range f.statements {
+			switch {
+			case strings.HasPrefix(s.query, `SELECT "id" FROM "settings"`), strings.HasPrefix(s.query, tt.change):
+				order = append(order, s.query[:6])
+			case strings.HasPrefix(s.query, `INSERT INTO "record_versions"`):
+				values := statementValues(s)
+				if values["event"] != tt.event {
+					t.Errorf("%s stored a %v version", tt.event, values["event"])
+				}
+				recorded = append(recorded, values["record_id"].(string))
+			}
+		}
+		if len(order) != 2 || order[0] != "SELECT" {
+			t.Errorf("%s: the matching records are not selected before the change: %v", tt.event, order)
+		}
+		if !reflect.DeepEqual(recorded, matching) {
+			t.Errorf("%s: stored versions of %v, want %v", tt.event, recorded, matching)
+		}
+	}
+}